@@ -0,0 +1,181 @@
+package neogate
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errHTTPSession = errors.New("sessions of http actions can't receive events")
+
+// Actions registered by neogate itself. They act on connected sessions, so they're only exposed in case they're listed.
+var builtinActions = []string{ReauthAction, ListSessionsAction, RevokeSessionsAction}
+
+// Config for invoking actions over plain http using MountActions or ActionsHandler.
+type HTTPActionConfig[T any] struct {
+
+	// Called for every request to create the session the action runs in. Return the session info and true if the request is allowed.
+	// Config.Handshake is used in case this isn't specified (all requests are rejected in case neither is).
+	Authenticate func(req *HandshakeRequest) (SessionInfo[T], bool)
+
+	// Actions that can be invoked over http (all registered actions except the built-in ones like RevokeSessionsAction in case it's empty).
+	Actions []string
+}
+
+// Mount POST /actions/:name to invoke actions registered using CreateHandlerFor over plain http using a fiber router.
+//
+// The body of the request is the data of the action, the body of the response is the data of the response event
+// (sent with status 400 in case it's an error response).
+func (instance *Instance[T]) MountActions(router fiber.Router, config HTTPActionConfig[T]) {
+	router.Post("/actions/:name", func(c *fiber.Ctx) error {
+		status, body := instance.invokeHTTPAction(fiberHandshakeRequest(c), c.Params("name"), c.Body(), config)
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Status(status).Send(body)
+	})
+}
+
+// Create a net/http handler for POST /actions/{name} to invoke actions registered using CreateHandlerFor over plain http.
+//
+// The body of the request is the data of the action, the body of the response is the data of the response event
+// (sent with status 400 in case it's an error response).
+func (instance *Instance[T]) ActionsHandler(config HTTPActionConfig[T]) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /actions/{name}", func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		status, body := instance.invokeHTTPAction(httpHandshakeRequest(r), r.PathValue("name"), data, config)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	})
+	return mux
+}
+
+// Run the action for an http request in a session that only exists for the request. Returns the status and body of the response.
+func (instance *Instance[T]) invokeHTTPAction(req *HandshakeRequest, action string, data []byte, config HTTPActionConfig[T]) (int, []byte) {
+
+	// Browsers send cookies with requests from other sites too (same check as for the gateway)
+	if !instance.checkOrigin(req) {
+		return http.StatusForbidden, httpActionError("origin not allowed")
+	}
+
+	authenticate := config.Authenticate
+	if authenticate == nil {
+		authenticate = instance.Config.Handshake
+	}
+	if authenticate == nil {
+		return http.StatusUnauthorized, httpActionError("unauthorized")
+	}
+	info, ok := authenticate(req)
+	if !ok {
+		return http.StatusUnauthorized, httpActionError("unauthorized")
+	}
+
+	// Only checked after authentication to not tell anyone which actions exist
+	route, ok := instance.routes[action]
+	exposed := slices.Contains(config.Actions, action) || (len(config.Actions) == 0 && !slices.Contains(builtinActions, action))
+	if !ok || !exposed {
+		return http.StatusNotFound, httpActionError("action not found")
+	}
+
+	// Wrap the data like a client would over websocket so handlers can parse it
+	if len(data) == 0 {
+		data = []byte("null")
+	}
+	if !sonic.Valid(data) {
+		return http.StatusBadRequest, httpActionError("body should be json")
+	}
+	message, err := sonic.Marshal(Message[sonic.NoCopyRawMessage]{
+		Action: action + ":http",
+		Data:   data,
+	})
+	if err != nil {
+		return http.StatusBadRequest, httpActionError("body should be json")
+	}
+
+	info.sessionId = GenerateToken(16)
+	info.metadata = instance.captureMetadata(req)
+	ctx := &Context[T]{
+		Session:    info.toSession(httpSessionConn{}),
+		Data:       message,
+		Action:     action,
+		ResponseId: "http",
+		Instance:   instance,
+	}
+
+	Log.Println("Handling http action: " + action)
+	response, ok := instance.runHTTPAction(route, ctx)
+	if !ok {
+		return http.StatusInternalServerError, httpActionError("Invalid request.")
+	}
+
+	body, err := sonic.Marshal(response.Data)
+	if err != nil {
+		instance.ReportGeneralError("couldn't marshal response of http action "+action, err)
+		return http.StatusInternalServerError, httpActionError("couldn't encode response")
+	}
+	return httpActionStatus(response.Data), body
+}
+
+// Get the status for the data of a response (error responses are sent as bad requests).
+func httpActionStatus(data any) int {
+	switch data := data.(type) {
+	case NormalResponseStruct:
+		if !data.Success {
+			return http.StatusBadRequest
+		}
+	case *NormalResponseStruct:
+		if data != nil && !data.Success {
+			return http.StatusBadRequest
+		}
+	}
+	return http.StatusOK
+}
+
+// Run the route and recover in case it panics (like route does for sessions).
+func (instance *Instance[T]) runHTTPAction(route func(*Context[T]) Event, ctx *Context[T]) (response Event, ok bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			Log.Println("recovered from error in http action", ctx.Action, "by", ctx.Session.userId, ":", err)
+			ok = false
+		}
+	}()
+
+	return route(ctx), true
+}
+
+func httpActionError(message string) []byte {
+	body, _ := sonic.Marshal(NormalResponseStruct{
+		Success: false,
+		Message: message,
+	})
+	return body
+}
+
+// Conn of the sessions created for http actions. They only exist for one request, so events can't be sent to them.
+type httpSessionConn struct{}
+
+func (httpSessionConn) ReadMessage() (int, []byte, error) {
+	return 0, nil, errHTTPSession
+}
+
+func (httpSessionConn) WriteMessage(messageType int, data []byte) error {
+	return errHTTPSession
+}
+
+func (httpSessionConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (httpSessionConn) Close() error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package neogate_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Liphium/neogate"
+	"github.com/bytedance/sonic"
+)
+
+func TestActionsHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []string // HTTPActionConfig.Actions
+		user    string
+		origin  string
+		action  string
+		body    string
+		status  int
+		message string // Message of the error response
+	}{
+		{name: "success", user: "alice", action: "echo", body: `{"message":"hi"}`, status: http.StatusOK},
+		{name: "empty body", user: "alice", action: "echo", status: http.StatusOK},
+		{name: "not authenticated", action: "echo", status: http.StatusUnauthorized, message: "unauthorized"},
+		{name: "unknown action", user: "alice", action: "nope", status: http.StatusNotFound, message: "action not found"},
+		{name: "unknown action without auth", action: "nope", status: http.StatusUnauthorized, message: "unauthorized"},
+		{name: "error response", user: "alice", action: "fail", status: http.StatusBadRequest, message: "nope"},
+		{name: "invalid json", user: "alice", action: "echo", body: `{`, status: http.StatusBadRequest, message: "body should be json"},
+		{name: "invalid data", user: "alice", action: "echo", body: `"text"`, status: http.StatusBadRequest, message: "Invalid request."},
+		{name: "panic", user: "alice", action: "panic", status: http.StatusInternalServerError, message: "Invalid request."},
+		{name: "other origin", user: "alice", origin: "https://evil.example", action: "echo", status: http.StatusForbidden, message: "origin not allowed"},
+		{name: "not listed", actions: []string{"fail"}, user: "alice", action: "echo", status: http.StatusNotFound, message: "action not found"},
+		{name: "listed", actions: []string{"echo"}, user: "alice", action: "echo", status: http.StatusOK},
+		{name: "built-in revoke", user: "alice", action: neogate.RevokeSessionsAction, body: `{"all_others":true}`, status: http.StatusNotFound, message: "action not found"},
+		{name: "built-in reauth", user: "alice", action: neogate.ReauthAction, status: http.StatusNotFound, message: "action not found"},
+		{name: "built-in listed", actions: []string{neogate.ListSessionsAction}, user: "alice", action: neogate.ListSessionsAction, status: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{
+				Handshake: func(req *neogate.HandshakeRequest) (neogate.SessionInfo[neogate.None], bool) {
+					return neogate.SessionInfo[neogate.None]{UserId: req.Get("User")}, req.Get("User") != ""
+				},
+				SessionActions: &neogate.SessionActionsConfig[neogate.None]{},
+			})
+			neogate.CreateHandlerFor(harness.Instance, "echo", func(c *neogate.Context[neogate.None], action map[string]string) neogate.Event {
+				return neogate.NormalResponse(c, action)
+			})
+			neogate.CreateHandlerFor(harness.Instance, "fail", func(c *neogate.Context[neogate.None], _ any) neogate.Event {
+				return neogate.ErrorResponse(c, "nope", nil)
+			})
+			neogate.CreateHandlerFor(harness.Instance, "panic", func(c *neogate.Context[neogate.None], _ any) neogate.Event {
+				panic("handler failed")
+			})
+
+			// Other sessions of the user must not be affected by anything sent over http
+			session := harness.Connect(t, "alice", neogate.None{})
+
+			req := httptest.NewRequest(http.MethodPost, "/actions/"+test.action, strings.NewReader(test.body))
+			if test.user != "" {
+				req.Header.Set("User", test.user)
+			}
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+			recorder := httptest.NewRecorder()
+			harness.Instance.ActionsHandler(neogate.HTTPActionConfig[neogate.None]{Actions: test.actions}).ServeHTTP(recorder, req)
+
+			if recorder.Code != test.status {
+				t.Fatalf("status = %d, want %d (%s)", recorder.Code, test.status, recorder.Body.String())
+			}
+			if test.message != "" {
+				var response neogate.NormalResponseStruct
+				if err := sonic.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Success || response.Message != test.message {
+					t.Fatalf("body = %s, want error response %q", recorder.Body.String(), test.message)
+				}
+			}
+			if !harness.Instance.ExistsConnection("alice", session.GetSessionId()) {
+				t.Fatal("session of alice was removed")
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package neogate
+
+import (
+	"time"
+)
+
+// Result of removing expired and orphaned adapters.
+type AdapterSweepResult struct {
+	Expired  int // Adapters removed because their TTL ran out
+	Orphaned int // Adapters removed because their owner isn't connected anymore
+}
+
+// Check if the adapter expired.
+func (adapter *Adapter) expired(now time.Time) bool {
+	return !adapter.ExpiresAt.IsZero() && !now.Before(adapter.ExpiresAt)
+}
+
+// Check if the owner of the adapter is gone (adapters without an owner are never orphaned).
+func (instance *Instance[T]) orphaned(adapter *Adapter) bool {
+	switch {
+	case adapter.OwnerSession != "":
+		return !instance.ExistsConnection(adapter.OwnerUser, adapter.OwnerSession)
+	case adapter.OwnerUser != "":
+		return instance.GetConnections(adapter.OwnerUser) == 0
+	default:
+		return false
+	}
+}
+
+// Remove all adapters that expired or whose owner isn't connected anymore.
+func (instance *Instance[T]) SweepAdapters() AdapterSweepResult {
+	result := AdapterSweepResult{}
+	now := time.Now()
+
+	instance.adapters.Range(func(_, value any) bool {
+		for _, adapter := range value.(*adapterEntry).listeners {
+			switch {
+			case adapter.expired(now):
+				if instance.removeAdapterInstance(adapter) {
+					result.Expired++
+				}
+			case instance.orphaned(adapter):
+				if instance.removeAdapterInstance(adapter) {
+					result.Orphaned++
+				}
+			}
+		}
+		return true
+	})
+
+	return result
+}
+
+// Sweep the adapters every Config.AdapterSweepInterval (until the instance is closed).
+func (instance *Instance[T]) runAdapterSweeper() {
+	ticker := time.NewTicker(instance.Config.AdapterSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-instance.closed:
+			return
+		}
+
+		result := instance.SweepAdapters()
+		if result.Expired == 0 && result.Orphaned == 0 {
+			continue
+		}
+
+		Log.Println("collected adapters:", result.Expired, "expired,", result.Orphaned, "orphaned")
+		if instance.Config.AdapterSweepHandler != nil {
+			instance.Config.AdapterSweepHandler(result)
+		}
+	}
+}
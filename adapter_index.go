@@ -0,0 +1,159 @@
+package neogate
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Separator of the segments of hierarchical adapter ids (e.g. room:42:member:1).
+const AdapterSeparator = ":"
+
+// Wildcards for adapter patterns. A segment that is exactly "*" matches any one segment and "**"
+// as the last segment matches one or more remaining segments (e.g. room:*:member:1 or room:42:**).
+const (
+	WildcardSegment = "*"
+	WildcardRest    = "**"
+)
+
+// Index of the adapter ids by their segments, so patterns don't have to check every adapter.
+type adapterIndex struct {
+	mutex *sync.RWMutex
+	root  *adapterNode
+}
+
+type adapterNode struct {
+	children   map[string]*adapterNode
+	id         string // Id of the adapter ending at this node
+	registered bool   // If an adapter ends at this node (the id can be empty)
+}
+
+func newAdapterIndex() *adapterIndex {
+	return &adapterIndex{
+		mutex: &sync.RWMutex{},
+		root:  &adapterNode{children: map[string]*adapterNode{}},
+	}
+}
+
+// Needs the mutex to be locked.
+func (index *adapterIndex) insert(id string) {
+	node := index.root
+	for _, segment := range strings.Split(id, AdapterSeparator) {
+		child, ok := node.children[segment]
+		if !ok {
+			child = &adapterNode{children: map[string]*adapterNode{}}
+			node.children[segment] = child
+		}
+		node = child
+	}
+	node.id = id
+	node.registered = true
+}
+
+// Needs the mutex to be locked.
+func (index *adapterIndex) remove(id string) {
+	segments := strings.Split(id, AdapterSeparator)
+	path := []*adapterNode{index.root}
+	for _, segment := range segments {
+		child, ok := path[len(path)-1].children[segment]
+		if !ok {
+			return
+		}
+		path = append(path, child)
+	}
+	path[len(path)-1].registered = false
+
+	// Remove the nodes that aren't needed anymore
+	for i := len(segments) - 1; i >= 0; i-- {
+		node := path[i+1]
+		if node.registered || len(node.children) > 0 {
+			return
+		}
+		delete(path[i].children, segments[i])
+	}
+}
+
+// Sorted ids of all adapters matching the pattern.
+func (index *adapterIndex) match(pattern string) []string {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	ids := []string{}
+	index.root.match(strings.Split(pattern, AdapterSeparator), &ids)
+	slices.Sort(ids)
+	return ids
+}
+
+func (node *adapterNode) match(segments []string, ids *[]string) {
+	if len(segments) == 0 {
+		if node.registered {
+			*ids = append(*ids, node.id)
+		}
+		return
+	}
+
+	switch segments[0] {
+	case WildcardRest:
+		if len(segments) == 1 {
+			for _, child := range node.children {
+				child.collect(ids)
+			}
+			return
+		}
+
+		// Only allowed as the last segment, otherwise it's a normal segment
+		if child, ok := node.children[segments[0]]; ok {
+			child.match(segments[1:], ids)
+		}
+	case WildcardSegment:
+		for _, child := range node.children {
+			child.match(segments[1:], ids)
+		}
+	default:
+		if child, ok := node.children[segments[0]]; ok {
+			child.match(segments[1:], ids)
+		}
+	}
+}
+
+// Add the ids of the node and everything below it.
+func (node *adapterNode) collect(ids *[]string) {
+	if node.registered {
+		*ids = append(*ids, node.id)
+	}
+	for _, child := range node.children {
+		child.collect(ids)
+	}
+}
+
+// Check if the adapter id matches the pattern (for ids that don't have to be registered, like the ones of histories).
+//
+// Uses an index with only the id, so patterns always match the same way as for MatchAdapters.
+func matchAdapterPattern(pattern string, id string) bool {
+	index := &adapterIndex{root: &adapterNode{children: map[string]*adapterNode{}}}
+	index.insert(id)
+
+	ids := []string{}
+	index.root.match(strings.Split(pattern, AdapterSeparator), &ids)
+	return len(ids) > 0
+}
+
+// Sorted ids of all adapters matching the pattern (see WildcardSegment and WildcardRest).
+func (instance *Instance[T]) MatchAdapters(pattern string) []string {
+	return instance.adapterIndex.match(pattern)
+}
+
+// Ids of all adapters matching any of the patterns (without duplicates).
+func (instance *Instance[T]) expandAdapters(patterns []string) []string {
+	expanded := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		for _, id := range instance.MatchAdapters(pattern) {
+			if !seen[id] {
+				seen[id] = true
+				expanded = append(expanded, id)
+			}
+		}
+	}
+	return expanded
+}
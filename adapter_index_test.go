@@ -0,0 +1,144 @@
+package neogate_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+)
+
+func TestAdapterPatternMatching(t *testing.T) {
+	tests := []struct {
+		pattern string
+		id      string
+		want    bool
+	}{
+		{"room:42", "room:42", true},
+		{"room:42", "room:43", false},
+		{"room:42", "room:42:member:1", false},
+		{"room:*", "room:42", true},
+		{"room:*", "room", false},
+		{"room:*", "room:42:member:1", false},
+		{"room:*:member:1", "room:42:member:1", true},
+		{"room:*:member:1", "room:42:member:2", false},
+		{"room:**", "room:42", true},
+		{"room:**", "room:42:member:1", true},
+		{"room:**", "room", false},
+		{"**:member", "room:member", false}, // Only special as the last segment
+		{"**:member", "**:member", true},
+		{"**", "room", true},
+		{"**", "", true},
+		{"*", "", true},
+		{"", "", true},
+		{"", "room", false},
+	}
+
+	for _, test := range tests {
+
+		// Addressing adapters and histories have to match the same ids
+		harness := newHarness(t, neogate.Config[neogate.None]{
+			History: []neogate.HistoryConfig{{Pattern: test.pattern}},
+		})
+		_, err := harness.Instance.Adapt(neogate.CreateAction{
+			ID:      test.id,
+			OnEvent: func(*neogate.AdapterContext) error { return nil },
+			OnError: func(error) {},
+		})
+		if err != nil {
+			t.Fatalf("couldn't register adapter %q: %s", test.id, err)
+		}
+
+		if got := slices.Contains(harness.Instance.MatchAdapters(test.pattern), test.id); got != test.want {
+			t.Errorf("MatchAdapters(%q) contains %q = %t, want %t", test.pattern, test.id, got, test.want)
+		}
+
+		if err := harness.Instance.SendOne(test.id, neogate.Event{Name: "hello"}); err != nil {
+			t.Fatalf("couldn't send to %q: %s", test.id, err)
+		}
+		history, err := harness.Instance.GetHistory(test.id)
+		if err != nil {
+			t.Fatalf("couldn't get history of %q: %s", test.id, err)
+		}
+		if got := len(history) > 0; got != test.want {
+			t.Errorf("history pattern %q matches %q = %t, want %t", test.pattern, test.id, got, test.want)
+		}
+	}
+}
+
+func TestMatchAdapters(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{})
+	ids := []string{"", "room", "room:1", "room:2", "room:1:member:a", "room:2:member:a", "room:2:member:b", "lobby:1"}
+	for _, id := range ids {
+		_, err := harness.Instance.Adapt(neogate.CreateAction{
+			ID:      id,
+			OnEvent: func(*neogate.AdapterContext) error { return nil },
+			OnError: func(error) {},
+		})
+		if err != nil {
+			t.Fatalf("couldn't register adapter %q: %s", id, err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"room:1", []string{"room:1"}},
+		{"room:3", []string{}},
+		{"room:*", []string{"room:1", "room:2"}},
+		{"room:*:member:a", []string{"room:1:member:a", "room:2:member:a"}},
+		{"room:2:member:*", []string{"room:2:member:a", "room:2:member:b"}},
+		{"room:**", []string{"room:1", "room:1:member:a", "room:2", "room:2:member:a", "room:2:member:b"}},
+		{"*", []string{"", "room"}},
+		{"**", ids},
+		{"", []string{""}},
+	}
+
+	for _, test := range tests {
+		want := slices.Sorted(slices.Values(test.want))
+		if got := harness.Instance.MatchAdapters(test.pattern); !slices.Equal(got, want) {
+			t.Errorf("MatchAdapters(%q) = %q, want %q", test.pattern, got, want)
+		}
+	}
+
+	// Removed adapters shouldn't be matched anymore (the nodes above them stay for the others)
+	harness.Instance.RemoveAdapter("room:2")
+	harness.Instance.RemoveAdapter("")
+	if got, want := harness.Instance.MatchAdapters("room:*"), []string{"room:1"}; !slices.Equal(got, want) {
+		t.Errorf("MatchAdapters(room:*) after removal = %q, want %q", got, want)
+	}
+	if got, want := harness.Instance.MatchAdapters("room:2:**"), []string{"room:2:member:a", "room:2:member:b"}; !slices.Equal(got, want) {
+		t.Errorf("MatchAdapters(room:2:**) after removal = %q, want %q", got, want)
+	}
+	if got, want := harness.Instance.MatchAdapters("*"), []string{"room"}; !slices.Equal(got, want) {
+		t.Errorf("MatchAdapters(*) after removal = %q, want %q", got, want)
+	}
+}
+
+func TestSendPattern(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{})
+	alice1 := harness.Connect(t, "alice", neogate.None{})
+	alice2 := harness.Connect(t, "alice", neogate.None{})
+	bob := harness.Connect(t, "bob", neogate.None{})
+
+	if err := harness.Instance.SendPattern([]string{"session:alice:*"}, neogate.Event{Name: "hello"}); err != nil {
+		t.Fatalf("couldn't send to pattern: %s", err)
+	}
+	alice1.ExpectEvent(t, "hello")
+	alice2.ExpectEvent(t, "hello")
+	bob.ExpectNoEvent(t, "hello", 50*time.Millisecond)
+
+	// Plain sends don't treat wildcards as patterns
+	err := harness.Instance.Send([]string{"session:bob:*"}, neogate.Event{Name: "literal"})
+	var sendErr *neogate.AdapterSendError
+	if !errors.As(err, &sendErr) || !errors.Is(sendErr.AdapterErrors["session:bob:*"], neogate.ErrAdapterNotFound) {
+		t.Fatalf("send to literal id with wildcard returned %v", err)
+	}
+	bob.ExpectNoEvent(t, "literal", 50*time.Millisecond)
+
+	if err := harness.Instance.SendPattern([]string{"session:carol:*"}, neogate.Event{Name: "nobody"}); !errors.Is(err, neogate.ErrAdapterNotFound) {
+		t.Fatalf("send to pattern without matches returned %v, want ErrAdapterNotFound", err)
+	}
+}
@@ -0,0 +1,130 @@
+package neogate
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Information about an adapter id and everything registered for it.
+type AdapterInfo struct {
+	ID       string         `json:"id"`
+	Shared   bool           `json:"shared"`
+	Adapters []AdapterStats `json:"adapters"`
+}
+
+// Statistics of an adapter.
+type AdapterStats struct {
+	OwnerUser    string    `json:"owner_user,omitempty"`
+	OwnerSession string    `json:"owner_session,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity,omitzero"` // When the adapter last handled an event
+
+	Delivered       int64         `json:"delivered"` // Events handled by OnEvent (including failed ones)
+	Errors          int64         `json:"errors"`
+	LastError       string        `json:"last_error,omitempty"`
+	AverageDuration time.Duration `json:"average_duration"` // Average duration of OnEvent (nanoseconds in json)
+	Queued          int           `json:"queued"`           // Events waiting in the mailbox
+	Dropped         int64         `json:"dropped"`          // Events dropped by the mailbox (overflow or removal)
+}
+
+type adapterStats struct {
+	mutex        *sync.Mutex
+	createdAt    time.Time
+	lastActivity time.Time
+	delivered    int64
+	errors       int64
+	lastError    string
+	total        time.Duration // Time spent in OnEvent
+	dropped      int64
+}
+
+func newAdapterStats() *adapterStats {
+	return &adapterStats{
+		mutex:     &sync.Mutex{},
+		createdAt: time.Now(),
+	}
+}
+
+// Record an event handled by the adapter.
+func (stats *adapterStats) record(start time.Time, err error) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	stats.lastActivity = time.Now()
+	stats.total += stats.lastActivity.Sub(start)
+	stats.delivered++
+	if err != nil {
+		stats.errors++
+		stats.lastError = err.Error()
+	}
+}
+
+// Record events dropped by the mailbox of the adapter.
+func (stats *adapterStats) drop(events int) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	stats.dropped += int64(events)
+}
+
+// Get the current statistics of the adapter.
+func (adapter *Adapter) Stats() AdapterStats {
+	adapter.stats.mutex.Lock()
+	defer adapter.stats.mutex.Unlock()
+
+	stats := AdapterStats{
+		OwnerUser:    adapter.OwnerUser,
+		OwnerSession: adapter.OwnerSession,
+		ExpiresAt:    adapter.ExpiresAt,
+		CreatedAt:    adapter.stats.createdAt,
+		LastActivity: adapter.stats.lastActivity,
+		Delivered:    adapter.stats.delivered,
+		Errors:       adapter.stats.errors,
+		LastError:    adapter.stats.lastError,
+		Dropped:      adapter.stats.dropped,
+	}
+	if adapter.stats.delivered > 0 {
+		stats.AverageDuration = adapter.stats.total / time.Duration(adapter.stats.delivered)
+	}
+	if adapter.mailbox != nil {
+		stats.Queued = len(adapter.mailbox.queue)
+	}
+	return stats
+}
+
+func (entry *adapterEntry) info(id string) AdapterInfo {
+	info := AdapterInfo{
+		ID:       id,
+		Shared:   entry.shared,
+		Adapters: []AdapterStats{},
+	}
+	for _, adapter := range entry.listeners {
+		info.Adapters = append(info.Adapters, adapter.Stats())
+	}
+	return info
+}
+
+// All registered adapters (sorted by id).
+func (instance *Instance[T]) ListAdapters() []AdapterInfo {
+	adapters := []AdapterInfo{}
+	instance.adapters.Range(func(key, value any) bool {
+		adapters = append(adapters, value.(*adapterEntry).info(key.(string)))
+		return true
+	})
+	slices.SortFunc(adapters, func(a, b AdapterInfo) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return adapters
+}
+
+// Get the adapters registered for the id.
+func (instance *Instance[T]) GetAdapter(id string) (AdapterInfo, bool) {
+	obj, ok := instance.adapters.Load(id)
+	if !ok {
+		return AdapterInfo{}, false
+	}
+	return obj.(*adapterEntry).info(id), true
+}
@@ -2,7 +2,10 @@ package neogate
 
 import (
 	"errors"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type AdapterFunc = func(*AdapterContext) error
@@ -11,71 +14,335 @@ type Adapter struct {
 	ID    string      // Identifier of the adapter
 	Mutex *sync.Mutex // Mutex to prevent concurrent exceptions (can happen with connections, better handle this on the neogate level)
 
+	// Metadata of the session the adapter was created for (nil for adapters that don't belong to a session)
+	Metadata *SessionMetadata
+
+	// Owner of the adapter (removed by SweepAdapters once the owner isn't connected anymore)
+	OwnerUser    string
+	OwnerSession string
+	ExpiresAt    time.Time // When the adapter is removed (zero = never)
+
 	// Functions
 	OnEvent AdapterFunc
 	OnError func(error)
+
+	mailbox  *mailbox // Queue for asynchronous delivery (nil = events are delivered synchronously)
+	stats    *adapterStats
+	internal bool // Adapter of a session or user
 }
 
 type AdapterContext struct {
-	Event   *Event
-	Message []byte
-	Adapter *Adapter
+	Event    *Event
+	Message  []byte
+	Adapter  *Adapter
+	Metadata *SessionMetadata // Metadata of the session the adapter belongs to (nil if it doesn't belong to one)
 }
 
 type Event struct {
 	Name string `json:"name"`
 	Data any    `json:"data"`
+
+	// Envelope metadata (filled in when sending in case Config.EventMetadata is enabled, left out of the json when empty)
+	ID            string `json:"id,omitempty"`             // Unique id of the event (the same for every receiver)
+	Timestamp     int64  `json:"ts,omitempty"`             // When the event was sent (unix milliseconds)
+	Origin        string `json:"origin,omitempty"`         // Node that sent the event (Config.NodeID)
+	CorrelationID string `json:"correlation_id,omitempty"` // Id of the event or request this one belongs to (set by the sender)
 }
 
 type CreateAction struct {
-	ID      string      // Id of the adapter
-	OnEvent AdapterFunc // Function that handles events received by the adapter
-	OnError func(error) // Function that handles errors encountered by the adapter
+	ID       string           // Id of the adapter
+	OnEvent  AdapterFunc      // Function that handles events received by the adapter
+	OnError  func(error)      // Function that handles errors encountered by the adapter
+	Metadata *SessionMetadata // Metadata of the session the adapter belongs to (optional)
+
+	// Owner of the adapter: the adapter is removed by SweepAdapters once the session (or all sessions of the user
+	// in case OwnerSession isn't specified) disconnected. Adapters without an owner are only removed manually.
+	OwnerUser    string
+	OwnerSession string
+	TTL          time.Duration // How long the adapter lives (0 = forever)
+
+	// Deliver events asynchronously using a mailbox (Config.AdapterMailbox is used in case it's nil)
+	Mailbox *MailboxConfig
+
+	// Add the adapter to the other shared adapters of the id instead of it being the only one
+	// (events are passed to all of them, ids are either shared or not).
+	Shared bool
+
+	// Pass the history of the id (see Config.History) to the adapter before any new events. Events sent while the
+	// adapter is registered can be received twice (compare their ids in case Config.EventMetadata is enabled).
+	Replay bool
+
+	internal bool // Adapter of a session or user
+}
+
+// What happens when an adapter is registered for an id that already has one (see CreateAction.Shared).
+type AdapterConflictPolicy int
+
+const (
+	AdapterConflictReplace AdapterConflictPolicy = iota // Remove the existing adapters of the id
+	AdapterConflictReject                               // Don't register the new adapter (Adapt returns ErrAdapterExists)
+	AdapterConflictKeep                                 // Don't register the new adapter and return a subscription of the existing one (its Remove does nothing)
+)
+
+var ErrAdapterExists = errors.New("adapter already exists")
+var ErrAdapterNotFound = errors.New("adapter not found")
+
+// All adapters registered for an id. Never changed after it's stored (a new entry replaces it).
+type adapterEntry struct {
+	shared    bool
+	listeners []*Adapter
+}
+
+// Handle of an adapter returned by Adapt.
+type Subscription struct {
+	Adapter *Adapter
+	remove  func() bool
+}
+
+// Remove the adapter (other adapters of the same id stay). Returns false in case it was already removed.
+func (subscription *Subscription) Remove() bool {
+	return subscription.remove()
 }
 
 // Register a new adapter for websocket/sl (all safe protocols)
-func (instance *Instance[T]) Adapt(createAction CreateAction) {
-	_, ok := instance.adapters.Load(createAction.ID)
-	if ok {
-		instance.adapters.Delete(createAction.ID)
-		Log.Printf("Replacing adapter for target %s \n", createAction.ID)
-	}
-
-	instance.adapters.Store(createAction.ID, &Adapter{
-		ID:      createAction.ID,
-		Mutex:   &sync.Mutex{},
-		OnEvent: createAction.OnEvent,
-		OnError: createAction.OnError,
-	})
+//
+// Ids can be hierarchical (segments separated by AdapterSeparator), so a group of adapters can be addressed using SendPattern.
+// In case the id already has an adapter, Config.AdapterConflictPolicy decides what happens (unless both are shared,
+// the adapters of sessions and users always replace existing ones).
+func (instance *Instance[T]) Adapt(createAction CreateAction) (*Subscription, error) {
+	if createAction.Replay {
+		return instance.adaptWithReplay(createAction)
+	}
+
+	subscription, _, err := instance.register(createAction)
+	return subscription, err
+}
+
+// Register the adapter (locked in case the history should be replayed). Returns whether a new adapter was registered.
+func (instance *Instance[T]) register(createAction CreateAction) (*Subscription, bool, error) {
+	instance.adapterIndex.mutex.Lock()
+	defer instance.adapterIndex.mutex.Unlock()
+
+	entry := &adapterEntry{shared: createAction.Shared}
+	if obj, ok := instance.adapters.Load(createAction.ID); ok {
+		existing := obj.(*adapterEntry)
+
+		// Sessions and users always need their adapter, so the policy doesn't apply to them
+		policy := instance.Config.AdapterConflictPolicy
+		if createAction.internal {
+			policy = AdapterConflictReplace
+		}
+
+		switch {
+		case existing.shared && createAction.Shared:
+			entry.listeners = slices.Clone(existing.listeners)
+		case policy == AdapterConflictReject:
+			return nil, false, ErrAdapterExists
+		case policy == AdapterConflictKeep:
+
+			// The existing adapter belongs to whoever registered it, so it can't be removed using this subscription
+			return &Subscription{
+				Adapter: existing.listeners[0],
+				remove:  func() bool { return false },
+			}, false, nil
+		default:
+			for _, listener := range existing.listeners {
+				listener.stop()
+			}
+			Log.Printf("Replacing adapter for target %s \n", createAction.ID)
+		}
+	}
+
+	adapter := &Adapter{
+		ID:           createAction.ID,
+		Mutex:        &sync.Mutex{},
+		Metadata:     createAction.Metadata,
+		OwnerUser:    createAction.OwnerUser,
+		OwnerSession: createAction.OwnerSession,
+		OnEvent:      createAction.OnEvent,
+		OnError:      createAction.OnError,
+		stats:        newAdapterStats(),
+		internal:     createAction.internal,
+	}
+	if createAction.TTL > 0 {
+		adapter.ExpiresAt = time.Now().Add(createAction.TTL)
+	}
+
+	mailboxConfig := createAction.Mailbox
+	if mailboxConfig == nil {
+		mailboxConfig = instance.Config.AdapterMailbox
+	}
+	adapter.mailbox = newMailbox(mailboxConfig, adapter)
+
+	if createAction.Replay {
+		adapter.Mutex.Lock()
+	}
+
+	entry.listeners = append(entry.listeners, adapter)
+	instance.adapters.Store(createAction.ID, entry)
+	instance.adapterIndex.insert(createAction.ID)
+	return instance.subscription(adapter), true, nil
 }
 
-// Remove an adapter from the instance
+func (instance *Instance[T]) subscription(adapter *Adapter) *Subscription {
+	return &Subscription{
+		Adapter: adapter,
+		remove: func() bool {
+			return instance.removeAdapterInstance(adapter)
+		},
+	}
+}
+
+// Remove an adapter from the instance (all adapters in case the id has multiple)
 func (instance *Instance[T]) RemoveAdapter(ID string) {
-	instance.adapters.Delete(ID)
+	instance.adapterIndex.mutex.Lock()
+	defer instance.adapterIndex.mutex.Unlock()
+
+	if obj, ok := instance.adapters.LoadAndDelete(ID); ok {
+		for _, listener := range obj.(*adapterEntry).listeners {
+			listener.stop()
+		}
+	}
+	instance.adapterIndex.remove(ID)
+}
+
+// Remove one adapter of an id (in case it wasn't removed in the meantime). Returns whether it was removed.
+func (instance *Instance[T]) removeAdapterInstance(adapter *Adapter) bool {
+	instance.adapterIndex.mutex.Lock()
+	defer instance.adapterIndex.mutex.Unlock()
+
+	obj, ok := instance.adapters.Load(adapter.ID)
+	if !ok {
+		return false
+	}
+	entry := obj.(*adapterEntry)
+	if !slices.Contains(entry.listeners, adapter) {
+		return false
+	}
+	adapter.stop()
+
+	// Remove the id completely in case it was the last adapter
+	if len(entry.listeners) == 1 {
+		instance.adapters.Delete(adapter.ID)
+		instance.adapterIndex.remove(adapter.ID)
+		return true
+	}
+
+	instance.adapters.Store(adapter.ID, &adapterEntry{
+		shared: entry.shared,
+		listeners: slices.DeleteFunc(slices.Clone(entry.listeners), func(listener *Adapter) bool {
+			return listener == adapter
+		}),
+	})
+	return true
+}
+
+// Stop the worker of the adapter (in case it has a mailbox).
+func (adapter *Adapter) stop() {
+	if adapter.mailbox != nil {
+		adapter.mailbox.close(adapter)
+	}
 }
 
-// Handles receiving messages from the target and passes them to the adapter
+// Handles receiving messages from the target and passes them to the adapters of the id
 func (instance *Instance[T]) AdapterReceive(ID string, event Event, msg []byte) error {
 
 	obj, ok := instance.adapters.Load(ID)
 	if !ok {
-		return errors.New("adapter not found")
+		return ErrAdapterNotFound
+	}
+	return instance.receiveEntry(obj.(*adapterEntry), event, msg)
+}
+
+// Pass an event to all adapters of the entry.
+func (instance *Instance[T]) receiveEntry(entry *adapterEntry, event Event, msg []byte) error {
+	now := time.Now()
+	delivered := 0
+	errs := []error{}
+	for _, adapter := range entry.listeners {
+
+		// Expired adapters are treated as gone even if they haven't been swept yet
+		if adapter.expired(now) {
+			instance.removeAdapterInstance(adapter)
+			continue
+		}
+		delivered++
+
+		// Only queue the event in case the adapter has a mailbox
+		var err error
+		if adapter.mailbox != nil {
+			err = adapter.mailbox.push(adapter, mailboxItem{event: event, msg: msg})
+		} else {
+			err = adapter.deliver(event, msg)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
-	adapter := obj.(*Adapter)
 
+	if delivered == 0 {
+		return ErrAdapterNotFound
+	}
+	return errors.Join(errs...)
+}
+
+// Pass an event to the adapter.
+func (adapter *Adapter) deliver(event Event, msg []byte) error {
 	adapter.Mutex.Lock()
 	defer adapter.Mutex.Unlock()
 
+	return adapter.deliverLocked(event, msg)
+}
+
+// Pass an event to the adapter (needs the mutex of the adapter to be locked).
+func (adapter *Adapter) deliverLocked(event Event, msg []byte) error {
+	start := time.Now()
 	err := adapter.OnEvent(&AdapterContext{
-		Event:   &event,
-		Message: msg,
-		Adapter: adapter,
+		Event:    &event,
+		Message:  msg,
+		Adapter:  adapter,
+		Metadata: adapter.Metadata,
 	})
+	adapter.stats.record(start, err)
 
 	// Tell the adapter there was an error
 	if err != nil {
 		adapter.OnError(err)
-		Log.Printf("[ws] Error receiving message from target %s: %s \n", ID, err)
+		Log.Printf("[ws] Error receiving message from target %s: %s \n", adapter.ID, err)
 	}
 	return err
 }
+
+// Sorted list of the ids of all registered adapters.
+func (instance *Instance[T]) GetAdapterIds() []string {
+	adapters := []string{}
+	instance.adapters.Range(func(key, _ any) bool {
+		adapters = append(adapters, key.(string))
+		return true
+	})
+	slices.Sort(adapters)
+	return adapters
+}
+
+// Create a unique event id (a random prefix per instance and a counter, so it's cheap to do for every event).
+func (instance *Instance[T]) newEventId() string {
+	return instance.eventIdPrefix + "-" + strconv.FormatUint(instance.eventCounter.Add(1), 36)
+}
+
+// Fill in the envelope metadata of the event (only in case Config.EventMetadata is enabled, set fields are kept).
+func (instance *Instance[T]) stampEvent(event Event) Event {
+	if !instance.Config.EventMetadata {
+		return event
+	}
+
+	if event.ID == "" {
+		event.ID = instance.newEventId()
+	}
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().UnixMilli()
+	}
+	if event.Origin == "" {
+		event.Origin = instance.Config.NodeID
+	}
+	return event
+}
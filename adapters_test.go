@@ -0,0 +1,137 @@
+package neogate_test
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Liphium/neogate"
+)
+
+// Register an adapter for the id that adds its name to received whenever it gets an event.
+func adaptNamed(instance *neogate.Instance[neogate.None], id string, name string, shared bool, received *[]string, mutex *sync.Mutex) (*neogate.Subscription, error) {
+	return instance.Adapt(neogate.CreateAction{
+		ID:     id,
+		Shared: shared,
+		OnEvent: func(*neogate.AdapterContext) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			*received = append(*received, name)
+			return nil
+		},
+		OnError: func(error) {},
+	})
+}
+
+func TestAdapterConflictPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  neogate.AdapterConflictPolicy
+		shared  [2]bool // If the first and second adapter are shared
+		err     error   // Returned when registering the second adapter
+		kept    bool    // If the subscription of the second adapter is the one of the first
+		receive []string
+		removeA bool     // Result of removing the first adapter
+		afterA  []string // Adapters receiving events after the first one was removed
+		removeB bool     // Result of removing the second adapter afterwards
+	}{
+		{name: "replace", policy: neogate.AdapterConflictReplace, receive: []string{"b"}, afterA: []string{"b"}, removeB: true},
+		{name: "reject", policy: neogate.AdapterConflictReject, err: neogate.ErrAdapterExists, receive: []string{"a"}, removeA: true},
+		{name: "keep", policy: neogate.AdapterConflictKeep, kept: true, receive: []string{"a"}, removeA: true},
+		{name: "shared", policy: neogate.AdapterConflictReject, shared: [2]bool{true, true}, receive: []string{"a", "b"}, removeA: true, afterA: []string{"b"}, removeB: true},
+		{name: "only first shared", policy: neogate.AdapterConflictReject, shared: [2]bool{true, false}, err: neogate.ErrAdapterExists, receive: []string{"a"}, removeA: true},
+		{name: "only second shared", policy: neogate.AdapterConflictReplace, shared: [2]bool{false, true}, receive: []string{"b"}, afterA: []string{"b"}, removeB: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{AdapterConflictPolicy: test.policy})
+			instance := harness.Instance
+
+			mutex := &sync.Mutex{}
+			received := []string{}
+			send := func(t *testing.T, want []string) {
+				t.Helper()
+
+				mutex.Lock()
+				received = []string{}
+				mutex.Unlock()
+				err := instance.SendOne("room", neogate.Event{Name: "hello"})
+				if len(want) == 0 {
+					if !errors.Is(adapterError(err, "room"), neogate.ErrAdapterNotFound) {
+						t.Fatalf("send to removed id returned %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("couldn't send: %s", err)
+				}
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				if got := slices.Sorted(slices.Values(received)); !slices.Equal(got, want) {
+					t.Fatalf("received by %q, want %q", got, want)
+				}
+			}
+
+			a, err := adaptNamed(instance, "room", "a", test.shared[0], &received, mutex)
+			if err != nil {
+				t.Fatalf("couldn't register first adapter: %s", err)
+			}
+			b, err := adaptNamed(instance, "room", "b", test.shared[1], &received, mutex)
+			if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("registering second adapter returned %v, want %v", err, test.err)
+			}
+			if test.kept && b.Adapter != a.Adapter {
+				t.Fatal("subscription isn't the one of the existing adapter")
+			}
+			send(t, test.receive)
+
+			// The subscription of a kept adapter belongs to whoever registered it
+			if test.kept && b.Remove() {
+				t.Fatal("removed kept adapter using the returned subscription")
+			}
+
+			if removed := a.Remove(); removed != test.removeA {
+				t.Fatalf("removing first adapter returned %t, want %t", removed, test.removeA)
+			}
+			if a.Remove() {
+				t.Fatal("removed first adapter twice")
+			}
+			send(t, test.afterA)
+
+			if b != nil && !test.kept {
+				if removed := b.Remove(); removed != test.removeB {
+					t.Fatalf("removing second adapter returned %t, want %t", removed, test.removeB)
+				}
+			}
+			if _, ok := instance.GetAdapter("room"); ok {
+				t.Fatal("id still has adapters after all were removed")
+			}
+		})
+	}
+}
+
+func TestInternalAdaptersIgnoreConflictPolicy(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{AdapterConflictPolicy: neogate.AdapterConflictReject})
+
+	mutex := &sync.Mutex{}
+	received := []string{}
+	if _, err := adaptNamed(harness.Instance, "user:alice", "squatter", false, &received, mutex); err != nil {
+		t.Fatalf("couldn't register adapter: %s", err)
+	}
+
+	// The user adapter replaces the existing one even though the policy rejects conflicts
+	session := harness.Connect(t, "alice", neogate.None{})
+	if err := harness.Instance.SendOne("user:alice", neogate.Event{Name: "hello"}); err != nil {
+		t.Fatalf("couldn't send: %s", err)
+	}
+	session.ExpectEvent(t, "hello")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(received) != 0 {
+		t.Fatalf("replaced adapter received %q", received)
+	}
+}
@@ -0,0 +1,250 @@
+package neogate
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/bytedance/sonic"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Config for the admin api mounted using MountAdmin.
+type AdminConfig struct {
+
+	// Called for every request to the admin api. Return true if the request is allowed.
+	// MUST BE SPECIFIED (all requests are rejected otherwise).
+	Authorize func(c *fiber.Ctx) bool
+
+	DefaultLimit int // Page size in case the request doesn't specify one (default: 50)
+	MaxLimit     int // Maximum page size a request can ask for (default: 500)
+}
+
+type AdminPage[E any] struct {
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Items  []E `json:"items"`
+}
+
+type AdminUser struct {
+	UserId   string   `json:"user_id"`
+	Sessions []string `json:"sessions"`
+}
+
+type AdminSession struct {
+	UserId    string `json:"user_id"`
+	SessionId string `json:"session_id"`
+	Data      any    `json:"data"`
+}
+
+type adminError struct {
+	Message string            `json:"message"`
+	Errors  map[string]string `json:"errors,omitempty"` // adapterId -> error (only for failed sends)
+}
+
+// Mount an http api for inspecting and controlling the sessions of this instance using a fiber router.
+//
+// Routes:
+//   - GET /users (paginated using ?offset=&limit=)
+//   - GET /users/:user
+//   - DELETE /users/:user (disconnects all sessions of the user)
+//   - POST /users/:user/send (body: event)
+//   - GET /users/:user/sessions/:session
+//   - DELETE /users/:user/sessions/:session
+//   - GET /adapters (paginated using ?offset=&limit=, items contain the stats of the adapters)
+//   - GET /adapters/:adapter
+//   - POST /adapters/:adapter/send (body: event)
+func (instance *Instance[T]) MountAdmin(router fiber.Router, config AdminConfig) {
+	if config.DefaultLimit <= 0 {
+		config.DefaultLimit = 50
+	}
+	if config.MaxLimit <= 0 {
+		config.MaxLimit = 500
+	}
+
+	// Make sure every request is authorized
+	router.Use(func(c *fiber.Ctx) error {
+		if config.Authorize == nil || !config.Authorize(c) {
+			return c.Status(fiber.StatusUnauthorized).JSON(adminError{Message: "unauthorized"})
+		}
+		return c.Next()
+	})
+
+	router.Get("/users", func(c *fiber.Ctx) error {
+		users := instance.GetUsers()
+		offset, limit, err := parsePagination(c, config)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(adminError{Message: err.Error()})
+		}
+
+		items := []AdminUser{}
+		for _, userId := range paginate(users, offset, limit) {
+			items = append(items, AdminUser{
+				UserId:   userId,
+				Sessions: instance.GetSessions(userId),
+			})
+		}
+		return c.JSON(AdminPage[AdminUser]{
+			Total:  len(users),
+			Offset: offset,
+			Limit:  limit,
+			Items:  items,
+		})
+	})
+
+	router.Get("/users/:user", func(c *fiber.Ctx) error {
+		userId := c.Params("user")
+		sessions := instance.GetSessions(userId)
+		if len(sessions) == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(adminError{Message: "user not connected"})
+		}
+
+		return c.JSON(AdminUser{
+			UserId:   userId,
+			Sessions: sessions,
+		})
+	})
+
+	router.Delete("/users/:user", func(c *fiber.Ctx) error {
+		userId := c.Params("user")
+		sessions := instance.GetSessions(userId)
+		if len(sessions) == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(adminError{Message: "user not connected"})
+		}
+
+		for _, sessionId := range sessions {
+			instance.DisconnectSession(userId, sessionId)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	router.Post("/users/:user/send", func(c *fiber.Ctx) error {
+		event, err := parseAdminEvent(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(adminError{Message: err.Error()})
+		}
+
+		return sendAdminResponse(c, instance.SendEventToUser(c.Params("user"), event))
+	})
+
+	router.Get("/users/:user/sessions/:session", func(c *fiber.Ctx) error {
+		session, ok := instance.Get(c.Params("user"), c.Params("session"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(adminError{Message: "session not found"})
+		}
+
+		return c.JSON(AdminSession{
+			UserId:    session.GetUserId(),
+			SessionId: session.GetSessionId(),
+			Data:      session.GetData(),
+		})
+	})
+
+	router.Delete("/users/:user/sessions/:session", func(c *fiber.Ctx) error {
+		userId, sessionId := c.Params("user"), c.Params("session")
+		if !instance.ExistsConnection(userId, sessionId) {
+			return c.Status(fiber.StatusNotFound).JSON(adminError{Message: "session not found"})
+		}
+
+		instance.DisconnectSession(userId, sessionId)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	router.Get("/adapters", func(c *fiber.Ctx) error {
+		adapters := instance.ListAdapters()
+		offset, limit, err := parsePagination(c, config)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(adminError{Message: err.Error()})
+		}
+
+		return c.JSON(AdminPage[AdapterInfo]{
+			Total:  len(adapters),
+			Offset: offset,
+			Limit:  limit,
+			Items:  paginate(adapters, offset, limit),
+		})
+	})
+
+	router.Get("/adapters/:adapter", func(c *fiber.Ctx) error {
+		adapter, ok := instance.GetAdapter(c.Params("adapter"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(adminError{Message: "adapter not found"})
+		}
+
+		return c.JSON(adapter)
+	})
+
+	router.Post("/adapters/:adapter/send", func(c *fiber.Ctx) error {
+		event, err := parseAdminEvent(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(adminError{Message: err.Error()})
+		}
+
+		return sendAdminResponse(c, instance.SendOne(c.Params("adapter"), event))
+	})
+}
+
+func parsePagination(c *fiber.Ctx, config AdminConfig) (int, int, error) {
+	offset, limit := 0, config.DefaultLimit
+
+	if value := c.Query("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("offset should be a positive number")
+		}
+		offset = parsed
+	}
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return 0, 0, errors.New("limit should be a positive number")
+		}
+		limit = min(parsed, config.MaxLimit)
+	}
+
+	return offset, limit, nil
+}
+
+func paginate[E any](items []E, offset int, limit int) []E {
+	if offset >= len(items) {
+		return []E{}
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
+
+func parseAdminEvent(c *fiber.Ctx) (Event, error) {
+	var event Event
+	if err := sonic.Unmarshal(c.Body(), &event); err != nil {
+		return Event{}, errors.New("body should be an event")
+	}
+	if event.Name == "" {
+		return Event{}, errors.New("event name is required")
+	}
+	return event, nil
+}
+
+func sendAdminResponse(c *fiber.Ctx, err error) error {
+	if err == nil {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	// Tell the caller which adapters failed (it's only a delivery failure in case some of them exist)
+	if sendErr, ok := err.(*AdapterSendError); ok {
+		errs := map[string]string{}
+		missing := 0
+		for adapter, err := range sendErr.AdapterErrors {
+			errs[adapter] = err.Error()
+			if errors.Is(err, ErrAdapterNotFound) {
+				missing++
+			}
+		}
+		if missing == len(errs) {
+			return c.Status(fiber.StatusNotFound).JSON(adminError{Message: "adapter not found", Errors: errs})
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(adminError{Message: "some adapters failed", Errors: errs})
+	}
+	if errors.Is(err, ErrNoSessions) || errors.Is(err, ErrAdapterNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(adminError{Message: err.Error()})
+	}
+	return c.Status(fiber.StatusBadGateway).JSON(adminError{Message: err.Error()})
+}
@@ -0,0 +1,212 @@
+package neogate
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config for limiting how many connections the gateway accepts (checked before Config.Handshake is called).
+type AdmissionConfig struct {
+	MaxSessions int // Maximum amount of concurrent sessions, including the ones still in the handshake (0 = unlimited)
+
+	// Token bucket for new connections (0 = unlimited)
+	ConnectRate  float64 // Connections per second
+	ConnectBurst int     // Connections allowed at once (default: ConnectRate)
+
+	// Token bucket for new connections per client ip (0 = unlimited)
+	IPConnectRate  float64 // Connections per second
+	IPConnectBurst int     // Connections allowed at once (default: IPConnectRate)
+
+	// Rejected clients are told to retry after RetryAfter plus a random duration up to RetryJitter,
+	// so they don't all reconnect at the same time again.
+	RetryAfter  time.Duration // Default: 5s
+	RetryJitter time.Duration // Default: RetryAfter
+}
+
+// How long buckets of ips have to be unused before they are removed.
+var admissionBucketIdle = time.Minute
+
+type admission struct {
+	config   AdmissionConfig
+	connect  *tokenBucket
+	sessions *atomic.Int64 // Slots reserved by connections (only counted in case there is a maximum)
+
+	ipMutex   *sync.Mutex
+	ipBuckets map[string]*tokenBucket // Ip -> bucket
+	lastSweep time.Time
+}
+
+func newAdmission(config AdmissionConfig) *admission {
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = 5 * time.Second
+	}
+	if config.RetryJitter <= 0 {
+		config.RetryJitter = config.RetryAfter
+	}
+
+	admission := &admission{
+		config:    config,
+		sessions:  &atomic.Int64{},
+		ipMutex:   &sync.Mutex{},
+		ipBuckets: map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+	if config.ConnectRate > 0 {
+		admission.connect = newTokenBucket(config.ConnectRate, config.ConnectBurst)
+	}
+	return admission
+}
+
+// Slot reserved for the session of a connection. Given back once, no matter how often it's released
+// (the session, Run and transports that fail to establish the connection all release it).
+type admissionSlot struct {
+	admission *admission
+	released  *atomic.Bool
+}
+
+func (slot *admissionSlot) release() {
+	if slot != nil && slot.released.CompareAndSwap(false, true) {
+		slot.admission.release()
+	}
+}
+
+// Check if a new connection can be accepted and reserve a slot for its session. Returns the error for the client in case it can't.
+//
+// The slot is given back once the session is closed (or using ReleaseAdmission in case it's never opened).
+func (instance *Instance[T]) admit(req *HandshakeRequest) (*admissionSlot, *HandshakeError) {
+	admission := instance.admission
+	if admission == nil {
+		return nil, nil
+	}
+
+	if !admission.reserve() {
+		return nil, admission.reject("too many sessions")
+	}
+
+	// Check the ip first so a single client can't use up the tokens of everyone else
+	if admission.config.IPConnectRate > 0 && !admission.ipBucket(instance.clientIP(req)).take() {
+		admission.release()
+		return nil, admission.reject("too many connections from this ip")
+	}
+	if admission.connect != nil && !admission.connect.take() {
+		admission.release()
+		return nil, admission.reject("too many connections")
+	}
+	return &admissionSlot{admission: admission, released: &atomic.Bool{}}, nil
+}
+
+// Give back the slot reserved by Accept for a connection that's never opened (e.g. because the upgrade failed).
+//
+// Sessions give back their slot once they're closed, so this is only needed by transports that don't call Run or Open.
+func (instance *Instance[T]) ReleaseAdmission(info SessionInfo[T]) {
+	info.slot.release()
+}
+
+// Reserve a slot for a session (concurrent handshakes can't take more slots than there are).
+func (admission *admission) reserve() bool {
+	if admission.config.MaxSessions <= 0 {
+		return true
+	}
+
+	for {
+		reserved := admission.sessions.Load()
+		if reserved >= int64(admission.config.MaxSessions) {
+			return false
+		}
+		if admission.sessions.CompareAndSwap(reserved, reserved+1) {
+			return true
+		}
+	}
+}
+
+func (admission *admission) release() {
+	if admission == nil || admission.config.MaxSessions <= 0 {
+		return
+	}
+	admission.sessions.Add(-1)
+}
+
+func (admission *admission) reject(reason string) *HandshakeError {
+	Log.Println("closed connection: overloaded,", reason)
+
+	retryAfter := admission.config.RetryAfter + rand.N(admission.config.RetryJitter+1)
+	return &HandshakeError{
+		Status:  http.StatusServiceUnavailable,
+		Message: reason,
+		Header: http.Header{
+			"Retry-After": []string{strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))},
+		},
+	}
+}
+
+func (admission *admission) ipBucket(ip string) *tokenBucket {
+	admission.ipMutex.Lock()
+	defer admission.ipMutex.Unlock()
+
+	// Remove buckets of ips that haven't connected in a while
+	if time.Since(admission.lastSweep) > admissionBucketIdle {
+		for ip, bucket := range admission.ipBuckets {
+			if bucket.idleSince() > admissionBucketIdle {
+				delete(admission.ipBuckets, ip)
+			}
+		}
+		admission.lastSweep = time.Now()
+	}
+
+	bucket, ok := admission.ipBuckets[ip]
+	if !ok {
+		bucket = newTokenBucket(admission.config.IPConnectRate, admission.config.IPConnectBurst)
+		admission.ipBuckets[ip] = bucket
+	}
+	return bucket
+}
+
+type tokenBucket struct {
+	mutex    *sync.Mutex
+	rate     float64 // Tokens per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	capacity := float64(burst)
+	if burst <= 0 {
+		capacity = math.Max(rate, 1)
+	}
+
+	return &tokenBucket{
+		mutex:    &sync.Mutex{},
+		rate:     rate,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+func (bucket *tokenBucket) take() bool {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	now := time.Now()
+	bucket.tokens = math.Min(bucket.capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (bucket *tokenBucket) idleSince() time.Duration {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	return time.Since(bucket.last)
+}
@@ -0,0 +1,164 @@
+package neogate_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+	"github.com/Liphium/neogate/neogatetest"
+)
+
+func TestAdmissionTokenBucket(t *testing.T) {
+	tests := []struct {
+		name      string
+		admission neogate.AdmissionConfig
+		attempts  []time.Duration // Time to wait before each attempt
+		want      []bool          // If the attempts are accepted
+	}{
+		{
+			name:      "unlimited",
+			admission: neogate.AdmissionConfig{},
+			attempts:  []time.Duration{0, 0, 0},
+			want:      []bool{true, true, true},
+		},
+		{
+			name:      "burst defaults to rate",
+			admission: neogate.AdmissionConfig{ConnectRate: 2},
+			attempts:  []time.Duration{0, 0, 0},
+			want:      []bool{true, true, false},
+		},
+		{
+			name:      "rate below one allows one",
+			admission: neogate.AdmissionConfig{ConnectRate: 0.1},
+			attempts:  []time.Duration{0, 0},
+			want:      []bool{true, false},
+		},
+		{
+			name:      "burst",
+			admission: neogate.AdmissionConfig{ConnectRate: 1, ConnectBurst: 3},
+			attempts:  []time.Duration{0, 0, 0, 0},
+			want:      []bool{true, true, true, false},
+		},
+		{
+			name:      "refill",
+			admission: neogate.AdmissionConfig{ConnectRate: 20, ConnectBurst: 1},
+			attempts:  []time.Duration{0, 0, 80 * time.Millisecond},
+			want:      []bool{true, false, true},
+		},
+		{
+			name:      "ip",
+			admission: neogate.AdmissionConfig{IPConnectRate: 1},
+			attempts:  []time.Duration{0, 0},
+			want:      []bool{true, false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{Admission: &test.admission})
+
+			for i, wait := range test.attempts {
+				time.Sleep(wait)
+				_, handshakeErr := harness.Instance.Accept(&neogate.HandshakeRequest{
+					RemoteAddr: "203.0.113.1:4000",
+					Header:     http.Header{"User": []string{"alice"}},
+				})
+
+				if accepted := handshakeErr == nil; accepted != test.want[i] {
+					t.Fatalf("attempt %d: accepted = %t, want %t", i, accepted, test.want[i])
+				}
+				if handshakeErr != nil && (handshakeErr.Status != http.StatusServiceUnavailable || handshakeErr.Header.Get("Retry-After") == "") {
+					t.Fatalf("attempt %d: rejected with status %d and Retry-After %q", i, handshakeErr.Status, handshakeErr.Header.Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
+
+func TestAdmissionBucketPerIP(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{
+		Admission: &neogate.AdmissionConfig{IPConnectRate: 1},
+	})
+
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+		_, handshakeErr := harness.Instance.Accept(&neogate.HandshakeRequest{
+			RemoteAddr: ip + ":4000",
+			Header:     http.Header{"User": []string{"alice"}},
+		})
+		if handshakeErr != nil {
+			t.Fatalf("connection from %s was rejected: %s", ip, handshakeErr)
+		}
+	}
+}
+
+func TestAdmissionMaxSessions(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(t *testing.T, harness *neogatetest.Harness[neogate.None], info neogate.SessionInfo[neogate.None]) // Ends the session of the connection
+	}{
+		{
+			name: "closed by client",
+			end: func(t *testing.T, harness *neogatetest.Harness[neogate.None], info neogate.SessionInfo[neogate.None]) {
+				harness.ConnectInfo(t, info).Close()
+			},
+		},
+		{
+			name: "disconnected by gateway",
+			end: func(t *testing.T, harness *neogatetest.Harness[neogate.None], info neogate.SessionInfo[neogate.None]) {
+				session := harness.ConnectInfo(t, info)
+				harness.Instance.DisconnectSession(session.GetUserId(), session.GetSessionId())
+				session.ExpectDisconnected(t)
+			},
+		},
+		{
+			name: "rejected by session limit",
+			end: func(t *testing.T, harness *neogatetest.Harness[neogate.None], info neogate.SessionInfo[neogate.None]) {
+				info.UserId = "full" // Already has the maximum amount of sessions
+				if _, ok := harness.Instance.Open(neogatetest.NewConn(), info); ok {
+					t.Fatal("session over the limit was opened")
+				}
+			},
+		},
+		{
+			name: "run by transport",
+			end: func(t *testing.T, harness *neogatetest.Harness[neogate.None], info neogate.SessionInfo[neogate.None]) {
+				conn := neogatetest.NewConn()
+				conn.Close()
+				harness.Instance.Run(conn, info)
+			},
+		},
+		{
+			name: "never opened",
+			end: func(t *testing.T, harness *neogatetest.Harness[neogate.None], info neogate.SessionInfo[neogate.None]) {
+				harness.Instance.ReleaseAdmission(info)
+				harness.Instance.ReleaseAdmission(info) // Only given back once
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{
+				Admission:          &neogate.AdmissionConfig{MaxSessions: 1},
+				MaxSessionsPerUser: 1,
+			})
+			harness.Connect(t, "full", neogate.None{}) // Not accepted by a transport, so it doesn't have a slot
+
+			accept := func() (neogate.SessionInfo[neogate.None], *neogate.HandshakeError) {
+				return harness.Instance.Accept(&neogate.HandshakeRequest{Header: http.Header{"User": []string{"alice"}}})
+			}
+
+			for i := range 3 {
+				info, handshakeErr := accept()
+				if handshakeErr != nil {
+					t.Fatalf("connection %d was rejected: %s", i, handshakeErr)
+				}
+				if _, handshakeErr := accept(); handshakeErr == nil || handshakeErr.Status != http.StatusServiceUnavailable {
+					t.Fatalf("connection over the maximum returned %v", handshakeErr)
+				}
+				test.end(t, harness, info)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package neogate
+
+import (
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+// Name of the event sent to the client once the first message authenticated it (data: {"success": true}).
+const AuthenticatedEvent = "authenticated"
+
+// Close reason for clients that failed to authenticate with their first message.
+const AuthFailedCloseReason = "authentication failed"
+
+// Read the first message of the connection and authenticate the session with it (Config.Authenticate).
+func (instance *Instance[T]) authenticate(conn Conn, req *HandshakeRequest) (SessionInfo[T], bool) {
+	timeout := instance.Config.AuthTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		Log.Println("closed connection: no auth message:", err)
+		return SessionInfo[T]{}, false
+	}
+
+	info, ok := instance.Config.Authenticate(req, msg)
+	if !ok {
+		Log.Println("closed connection: invalid auth message")
+		writeCloseReason(conn, AuthFailedCloseReason)
+		return SessionInfo[T]{}, false
+	}
+
+	if handshakeErr := instance.checkSessionLimit(info.UserId); handshakeErr != nil {
+		writeCloseReason(conn, handshakeErr.Message)
+		return SessionInfo[T]{}, false
+	}
+
+	// Create a unique session id to identify this specific session
+	info.sessionId = instance.newSessionId(info.UserId)
+	info.metadata = instance.captureMetadata(req)
+	info.authenticated = true
+
+	return info, true
+}
+
+// Tell the client why the connection is closed (using a close message).
+func writeCloseReason(conn Conn, reason string) error {
+	return conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+}
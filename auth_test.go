@@ -0,0 +1,109 @@
+package neogate_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+	"github.com/Liphium/neogate/neogatetest"
+	"github.com/bytedance/sonic"
+)
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string // First message of the client (empty = nothing is sent)
+		reason  string // Close reason (empty = the session is opened)
+	}{
+		{name: "authenticated", message: `{"token":"alice"}`},
+		{name: "invalid token", message: `{"token":""}`, reason: neogate.AuthFailedCloseReason},
+		{name: "invalid message", message: `hello`, reason: neogate.AuthFailedCloseReason},
+		{name: "session limit", message: `{"token":"full"}`, reason: neogate.SessionLimitCloseReason},
+		{name: "timeout"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{
+				Authenticate: func(req *neogate.HandshakeRequest, message []byte) (neogate.SessionInfo[neogate.None], bool) {
+					var auth struct {
+						Token string `json:"token"`
+					}
+					if err := sonic.Unmarshal(message, &auth); err != nil || auth.Token == "" {
+						return neogate.SessionInfo[neogate.None]{}, false
+					}
+					return neogate.SessionInfo[neogate.None]{UserId: auth.Token}, true
+				},
+				AuthTimeout:        50 * time.Millisecond,
+				MaxSessionsPerUser: 1,
+			})
+			harness.Connect(t, "full", neogate.None{})
+
+			// The handshake doesn't authenticate anything
+			info, handshakeErr := harness.Instance.Accept(&neogate.HandshakeRequest{Header: http.Header{}})
+			if handshakeErr != nil {
+				t.Fatalf("handshake failed: %s", handshakeErr)
+			}
+
+			conn := neogatetest.NewConn()
+			done := make(chan struct{})
+			go func() {
+				harness.Instance.Run(conn, info)
+				close(done)
+			}()
+			if test.message != "" {
+				if err := conn.Inject([]byte(test.message)); err != nil {
+					t.Fatalf("couldn't send auth message: %s", err)
+				}
+			}
+
+			if test.reason == "" && test.message != "" {
+				waitForEvent(t, conn, neogate.AuthenticatedEvent)
+				if sessions := harness.Instance.GetSessions("alice"); len(sessions) != 1 {
+					t.Fatalf("alice has %d sessions, want 1", len(sessions))
+				}
+
+				// The session stays open after the auth timeout
+				time.Sleep(100 * time.Millisecond)
+				if conn.IsClosed() {
+					t.Fatal("authenticated session was closed")
+				}
+				conn.Close()
+			}
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("connection wasn't closed")
+			}
+			if reason, ok := conn.CloseReason(); test.reason != "" && (!ok || reason != test.reason) {
+				t.Fatalf("connection was closed with reason %q (sent: %t), want %q", reason, ok, test.reason)
+			}
+			if sessions := harness.Instance.GetSessions("alice"); len(sessions) != 0 {
+				t.Fatalf("alice still has %d sessions", len(sessions))
+			}
+		})
+	}
+}
+
+// Wait until an event with the name was written to the connection.
+func waitForEvent(t *testing.T, conn *neogatetest.Conn, name string) {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	for {
+		for _, msg := range conn.Written() {
+			var event neogate.Event
+			if err := sonic.Unmarshal(msg, &event); err == nil && event.Name == name {
+				return
+			}
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("didn't receive event %s", name)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package neogate
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"github.com/fasthttp/websocket"
+)
+
+// How many errors a broadcast result keeps (the rest is only counted).
+var broadcastErrorLimit = 10
+
+// Result of sending an event to many sessions.
+type BroadcastResult struct {
+	Matched   int     // Sessions the event was sent to
+	Delivered int     // Sessions that received the event
+	Failed    int     // Sessions the event couldn't be sent to
+	Errors    []error // The first few errors (up to 10)
+}
+
+func (result *BroadcastResult) addError(session string, err error) {
+	result.Failed++
+	if len(result.Errors) < broadcastErrorLimit {
+		result.Errors = append(result.Errors, errors.New(session+": "+err.Error()))
+	}
+}
+
+// Implemented by websocket connections (also the ones of fiber) to write messages that were only framed once.
+type preparedWriter interface {
+	WritePreparedMessage(pm *websocket.PreparedMessage) error
+}
+
+// Send an event to every session connected to this instance. The event is only marshaled once
+// (and only encoded and framed once in case Config.SharedEncoding is enabled).
+func (instance *Instance[T]) BroadcastAll(event Event) (BroadcastResult, error) {
+	msg, err := sonic.Marshal(instance.stampEvent(event))
+	if err != nil {
+		return BroadcastResult{}, err
+	}
+
+	return instance.broadcast(instance.tagged(nil), msg), nil
+}
+
+// Send a marshaled event to the sessions (using Config.BroadcastWorkers goroutines).
+func (instance *Instance[T]) broadcast(sessions []*Session[T], msg []byte) BroadcastResult {
+	result := BroadcastResult{Matched: len(sessions)}
+	if len(sessions) == 0 {
+		return result
+	}
+
+	// Encode the message once in case it's the same for every session
+	var encoded []byte
+	var prepared *websocket.PreparedMessage
+	if instance.Config.SharedEncoding {
+		var err error
+		if encoded, err = instance.Config.EncodingMiddleware(sessions[0], instance, msg); err != nil {
+			for _, session := range sessions {
+				result.addError(session.sessionId, err)
+			}
+			return result
+		}
+
+		if prepared, err = websocket.NewPreparedMessage(websocket.BinaryMessage, encoded); err != nil {
+			instance.ReportGeneralError("couldn't prepare broadcast", err)
+		}
+	}
+
+	send := func(session *Session[T]) error {
+		if encoded == nil {
+			return instance.sendToSessionWS(session, msg)
+		}
+		if writer, ok := session.conn.(preparedWriter); ok && prepared != nil {
+			session.wsMutex.Lock()
+			defer session.wsMutex.Unlock()
+
+			if session.closed {
+				return ErrSessionClosed
+			}
+			return writer.WritePreparedMessage(prepared)
+		}
+		return session.writeMessage(encoded)
+	}
+
+	workers := instance.Config.BroadcastWorkers
+	if workers <= 0 {
+		workers = 16
+	}
+	workers = min(workers, len(sessions))
+
+	mutex := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	jobs := make(chan *Session[T])
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for session := range jobs {
+				err := send(session)
+
+				mutex.Lock()
+				if err != nil {
+					result.addError(session.sessionId, err)
+				} else {
+					result.Delivered++
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, session := range sessions {
+		jobs <- session
+	}
+	close(jobs)
+	wg.Wait()
+
+	return result
+}
@@ -0,0 +1,459 @@
+// Package client connects to a neogate gateway from Go.
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/fasthttp/websocket"
+)
+
+var (
+	ErrClosed       = errors.New("client closed")
+	ErrDisconnected = errors.New("disconnected before the response was received")
+	ErrNotConnected = errors.New("not connected to the gateway")
+)
+
+type Config struct {
+	URL    string      // Websocket url of the gateway (e.g. ws://localhost:3000/ws)
+	Header http.Header // Headers sent with the upgrade request (for the handshake)
+	Dialer *websocket.Dialer
+
+	// Creates the message sent right after every (re)connect, for gateways that authenticate sessions using their first message.
+	AuthMessage func() ([]byte, error)
+
+	// Reconnect in case the connection is lost (with exponential backoff between attempts)
+	Reconnect  bool
+	MinBackoff time.Duration // Delay before the first reconnect attempt (default: 500ms)
+	MaxBackoff time.Duration // Maximum delay between reconnect attempts (default: 30s)
+
+	// Called after every successful (re)connect, before the handlers get any events of the connection. Neogate doesn't
+	// resume sessions, so this is the place to restore whatever state the previous session had (subscriptions, etc.).
+	OnConnect func(client *Client)
+
+	// Called when the connection is lost (err is nil when the client was closed).
+	OnDisconnect func(err error)
+
+	// OnConnect, OnDisconnect and the handlers of events are all called one after another on the same goroutine
+	// (not the one reading from the connection), so they can use Request and Close.
+
+	// Codec middleware (has to match the encoding/decoding middleware of the gateway)
+	Encode func(message []byte) ([]byte, error)
+	Decode func(message []byte) ([]byte, error)
+}
+
+// Event received from the gateway.
+type Event struct {
+	Name string                 `json:"name"`
+	Data sonic.NoCopyRawMessage `json:"data"`
+
+	// Envelope metadata (only sent by gateways with event metadata enabled)
+	ID            string `json:"id,omitempty"`
+	Timestamp     int64  `json:"ts,omitempty"` // Unix milliseconds
+	Origin        string `json:"origin,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// Decode the data of the event into v.
+func (event Event) Decode(v any) error {
+	return sonic.Unmarshal(event.Data, v)
+}
+
+type Client struct {
+	config Config
+
+	connMutex  *sync.Mutex     // Guards conn and writing to it
+	conn       *websocket.Conn // Nil while reconnecting
+	closed     chan struct{}
+	closeOnce  *sync.Once
+	readerDone chan struct{}
+
+	handlerMutex *sync.RWMutex
+	handlers     map[string][]func(Event) // Event name -> handlers
+	anyHandlers  []func(Event)
+
+	// Calls to handlers waiting to be run by the dispatcher
+	queueMutex  *sync.Mutex
+	queueCond   *sync.Cond
+	queue       []func()
+	queueClosed bool
+
+	pendingMutex *sync.Mutex
+	pending      map[string]chan Event // Response id -> channel for the response
+}
+
+// Connect to the gateway. The returned client keeps reading events until it is closed.
+func Connect(ctx context.Context, config Config) (*Client, error) {
+	if config.Dialer == nil {
+		config.Dialer = websocket.DefaultDialer
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = 500 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 30 * time.Second
+	}
+
+	client := &Client{
+		config:       config,
+		connMutex:    &sync.Mutex{},
+		closed:       make(chan struct{}),
+		closeOnce:    &sync.Once{},
+		readerDone:   make(chan struct{}),
+		handlerMutex: &sync.RWMutex{},
+		handlers:     map[string][]func(Event){},
+		pendingMutex: &sync.Mutex{},
+		pending:      map[string]chan Event{},
+		queueMutex:   &sync.Mutex{},
+	}
+	client.queueCond = sync.NewCond(client.queueMutex)
+
+	conn, err := client.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client.conn = conn
+
+	if config.OnConnect != nil {
+		client.enqueue(func() { config.OnConnect(client) })
+	}
+	go client.dispatcher()
+	go client.read(conn)
+	return client, nil
+}
+
+func (client *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := client.config.Dialer.DialContext(ctx, client.config.URL, client.config.Header)
+	if err != nil || client.config.AuthMessage == nil {
+		return conn, err
+	}
+
+	// Authenticate before anything else is sent
+	msg, err := client.config.AuthMessage()
+	if err == nil {
+		err = conn.WriteMessage(websocket.TextMessage, msg)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Register a handler for events with the name (responses are never passed to handlers).
+//
+// Handlers are called one after another in the order the events were received, so don't block in them for too long.
+func (client *Client) On(name string, handler func(Event)) {
+	client.handlerMutex.Lock()
+	defer client.handlerMutex.Unlock()
+
+	client.handlers[name] = append(client.handlers[name], handler)
+}
+
+// Register a handler for all events (responses are never passed to handlers).
+func (client *Client) OnAny(handler func(Event)) {
+	client.handlerMutex.Lock()
+	defer client.handlerMutex.Unlock()
+
+	client.anyHandlers = append(client.anyHandlers, handler)
+}
+
+// Send an action to the gateway without waiting for the response. Returns the generated response id.
+func (client *Client) Send(action string, data any) (string, error) {
+	responseId := generateResponseId()
+	return responseId, client.send(action, responseId, data)
+}
+
+// Send an action to the gateway and wait for the response.
+func (client *Client) Request(ctx context.Context, action string, data any) (Event, error) {
+	responseId := generateResponseId()
+
+	// Register before sending to not miss a fast response
+	response := make(chan Event, 1)
+	client.pendingMutex.Lock()
+	client.pending[responseId] = response
+	client.pendingMutex.Unlock()
+
+	defer func() {
+		client.pendingMutex.Lock()
+		delete(client.pending, responseId)
+		client.pendingMutex.Unlock()
+	}()
+
+	if err := client.send(action, responseId, data); err != nil {
+		return Event{}, err
+	}
+
+	select {
+	case event, ok := <-response:
+		if !ok {
+			return Event{}, ErrDisconnected
+		}
+		return event, nil
+	case <-ctx.Done():
+		return Event{}, ctx.Err()
+	case <-client.closed:
+		return Event{}, ErrClosed
+	}
+}
+
+func (client *Client) send(action string, responseId string, data any) error {
+	msg, err := sonic.Marshal(map[string]any{
+		"action": action + ":" + responseId,
+		"data":   data,
+	})
+	if err != nil {
+		return err
+	}
+
+	if client.config.Encode != nil {
+		if msg, err = client.config.Encode(msg); err != nil {
+			return err
+		}
+	}
+
+	client.connMutex.Lock()
+	defer client.connMutex.Unlock()
+
+	select {
+	case <-client.closed:
+		return ErrClosed
+	default:
+	}
+	if client.conn == nil {
+		return ErrNotConnected
+	}
+	return client.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+// Close the connection and stop reconnecting. Waits until the connection isn't read from anymore
+// (handlers that are still queued are called afterwards).
+func (client *Client) Close() error {
+	var err error
+	client.closeOnce.Do(func() {
+		close(client.closed)
+
+		// There is nothing to close in case the connection is already gone (the reader stops reconnecting)
+		client.connMutex.Lock()
+		if client.conn != nil {
+			client.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			err = client.conn.Close()
+		}
+		client.connMutex.Unlock()
+	})
+
+	<-client.readerDone
+	return err
+}
+
+// Done returns a channel that is closed once the client is closed or gave up reconnecting.
+func (client *Client) Done() <-chan struct{} {
+	return client.readerDone
+}
+
+// Reads from the connection until it is closed (and reconnects in case that's enabled).
+func (client *Client) read(conn *websocket.Conn) {
+	defer close(client.readerDone)
+	defer client.closeQueue()
+
+	for {
+		err := client.readUntilError(conn)
+		client.connMutex.Lock()
+		client.conn = nil
+		client.connMutex.Unlock()
+		conn.Close()
+		client.failPending()
+
+		select {
+		case <-client.closed:
+			client.disconnected(nil)
+			return
+		default:
+		}
+
+		client.disconnected(err)
+		if !client.config.Reconnect {
+			client.closeOnce.Do(func() {
+				close(client.closed)
+			})
+			return
+		}
+
+		conn = client.reconnect()
+		if conn == nil {
+			return
+		}
+		if client.config.OnConnect != nil {
+			client.enqueue(func() { client.config.OnConnect(client) })
+		}
+	}
+}
+
+func (client *Client) disconnected(err error) {
+	if client.config.OnDisconnect != nil {
+		client.enqueue(func() { client.config.OnDisconnect(err) })
+	}
+}
+
+func (client *Client) readUntilError(conn *websocket.Conn) error {
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		if client.config.Decode != nil {
+			if msg, err = client.config.Decode(msg); err != nil {
+				return err
+			}
+		}
+
+		var event Event
+		if err := sonic.Unmarshal(msg, &event); err != nil {
+			return err
+		}
+		client.dispatch(event)
+	}
+}
+
+// Pass the event to the request waiting for it or to the handlers.
+func (client *Client) dispatch(event Event) {
+	if strings.HasPrefix(event.Name, "res:") {
+		responseId := event.Name[strings.LastIndex(event.Name, ":")+1:]
+
+		client.pendingMutex.Lock()
+		response, ok := client.pending[responseId]
+		if ok {
+			delete(client.pending, responseId)
+		}
+		client.pendingMutex.Unlock()
+
+		if ok {
+			response <- event
+		}
+		return
+	}
+
+	client.handlerMutex.RLock()
+	handlers := append(append([]func(Event){}, client.handlers[event.Name]...), client.anyHandlers...)
+	client.handlerMutex.RUnlock()
+
+	if len(handlers) == 0 {
+		return
+	}
+	client.enqueue(func() {
+		for _, handler := range handlers {
+			handler(event)
+		}
+	})
+}
+
+// Queue a call for the dispatcher.
+func (client *Client) enqueue(call func()) {
+	client.queueMutex.Lock()
+	defer client.queueMutex.Unlock()
+
+	client.queue = append(client.queue, call)
+	client.queueCond.Signal()
+}
+
+// Let the dispatcher stop once all queued calls are done.
+func (client *Client) closeQueue() {
+	client.queueMutex.Lock()
+	defer client.queueMutex.Unlock()
+
+	client.queueClosed = true
+	client.queueCond.Signal()
+}
+
+// Run the queued calls in order until the queue is closed.
+func (client *Client) dispatcher() {
+	for {
+		client.queueMutex.Lock()
+		for len(client.queue) == 0 && !client.queueClosed {
+			client.queueCond.Wait()
+		}
+		if len(client.queue) == 0 {
+			client.queueMutex.Unlock()
+			return
+		}
+		call := client.queue[0]
+		client.queue = client.queue[1:]
+		client.queueMutex.Unlock()
+
+		call()
+	}
+}
+
+// Tell all requests waiting for a response that the connection is gone.
+func (client *Client) failPending() {
+	client.pendingMutex.Lock()
+	defer client.pendingMutex.Unlock()
+
+	for responseId, response := range client.pending {
+		close(response)
+		delete(client.pending, responseId)
+	}
+}
+
+// Reconnect with exponential backoff until it works or the client is closed (returns nil then).
+func (client *Client) reconnect() *websocket.Conn {
+
+	// Stop dialing once the client is closed, Close waits for this
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-client.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := client.config.MinBackoff
+	for {
+
+		// Add some jitter so not every client reconnects at the same time
+		delay := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-client.closed:
+			return nil
+		case <-time.After(delay):
+		}
+
+		conn, err := client.dial(ctx)
+		if err == nil {
+			client.connMutex.Lock()
+			defer client.connMutex.Unlock()
+
+			// Make sure the client wasn't closed while dialing
+			select {
+			case <-client.closed:
+				conn.Close()
+				return nil
+			default:
+			}
+
+			client.conn = conn
+			return conn
+		}
+
+		backoff = min(backoff*2, client.config.MaxBackoff)
+	}
+}
+
+func generateResponseId() string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	id := make([]byte, 12)
+	for i := range id {
+		id[i] = letters[rand.N(len(letters))]
+	}
+	return string(id)
+}
@@ -0,0 +1,303 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+	"github.com/Liphium/neogate/client"
+	"github.com/fasthttp/websocket"
+)
+
+type echoAction struct {
+	Message string `json:"message"`
+}
+
+// Start a gateway using the net/http transport. Returns the instance and the websocket url.
+//
+// Actions: echo responds with the message, fail responds with an error, broadcast sends an event to the user
+// before responding, kick disconnects the session without responding.
+func newServer(t *testing.T) (*neogate.Instance[neogate.None], string) {
+	t.Helper()
+
+	instance := neogate.Setup(neogate.Config[neogate.None]{
+		Handshake: func(req *neogate.HandshakeRequest) (neogate.SessionInfo[neogate.None], bool) {
+			return neogate.SessionInfo[neogate.None]{UserId: req.Get("User")}, req.Get("User") != ""
+		},
+		SessionEnterNetworkHandler: func(*neogate.Session[neogate.None], neogate.None) bool {
+			return false
+		},
+		SessionDisconnectHandler: func(*neogate.Session[neogate.None]) {},
+		SessionAdapterHandler: func(userId string, sessionId string) (string, string) {
+			return "user:" + userId, "session:" + userId + ":" + sessionId
+		},
+		EncodingMiddleware: neogate.DefaultEncodingMiddleware[neogate.None],
+		DecodingMiddleware: neogate.DefaultDecodingMiddleware[neogate.None],
+	})
+	t.Cleanup(instance.Close)
+
+	neogate.CreateHandlerFor(instance, "echo", func(c *neogate.Context[neogate.None], action echoAction) neogate.Event {
+		return neogate.NormalResponse(c, action)
+	})
+	neogate.CreateHandlerFor(instance, "fail", func(c *neogate.Context[neogate.None], _ any) neogate.Event {
+		return neogate.ErrorResponse(c, "nope", nil)
+	})
+	neogate.CreateHandlerFor(instance, "broadcast", func(c *neogate.Context[neogate.None], action echoAction) neogate.Event {
+		if err := c.Instance.SendEventToUser(c.Session.GetUserId(), neogate.Event{Name: "broadcast", Data: action}); err != nil {
+			return neogate.ErrorResponse(c, "couldn't broadcast", err)
+		}
+		return neogate.SuccessResponse(c)
+	})
+	neogate.CreateHandlerFor(instance, "kick", func(c *neogate.Context[neogate.None], _ any) neogate.Event {
+		c.Instance.DisconnectSession(c.Session.GetUserId(), c.Session.GetSessionId())
+		return neogate.SuccessResponse(c)
+	})
+
+	server := httptest.NewServer(instance.HTTPHandler())
+	t.Cleanup(server.Close)
+	return instance, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func connect(t *testing.T, config client.Config) *client.Client {
+	t.Helper()
+
+	if config.Header == nil {
+		config.Header = map[string][]string{"User": {"alice"}}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c, err := client.Connect(ctx, config)
+	if err != nil {
+		t.Fatalf("couldn't connect: %s", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRequest(t *testing.T) {
+	_, url := newServer(t)
+	c := connect(t, client.Config{URL: url})
+
+	// Responses have to end up at the request they belong to, even when they arrive in a different order
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			message := strings.Repeat("x", i)
+			response, err := client.Request[echoAction](ctx, c, "echo", echoAction{Message: message})
+			if err != nil {
+				t.Errorf("request %d failed: %s", i, err)
+				return
+			}
+			if response.Message != message {
+				t.Errorf("request %d got response %q", i, response.Message)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := client.Request[any](ctx, c, "fail", nil)
+	var responseErr *client.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.Action != "fail" || responseErr.Message != "nope" {
+		t.Fatalf("error response returned %v", err)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	_, url := newServer(t)
+	c := connect(t, client.Config{URL: url})
+
+	received := make(chan string, 10)
+	c.On("broadcast", func(event client.Event) {
+		var data echoAction
+		if err := event.Decode(&data); err != nil {
+			t.Errorf("couldn't decode event: %s", err)
+		}
+		received <- "on:" + data.Message
+	})
+	c.OnAny(func(event client.Event) {
+		received <- "any:" + event.Name
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.Request(ctx, "broadcast", echoAction{Message: "hi"}); err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+
+	// Responses aren't passed to handlers
+	for _, want := range []string{"on:hi", "any:broadcast"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("handler got %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("handler didn't get %s", want)
+		}
+	}
+	select {
+	case got := <-received:
+		t.Fatalf("unexpected call of handler: %s", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDisconnectFailsPending(t *testing.T) {
+	_, url := newServer(t)
+	disconnected := make(chan error, 1)
+	c := connect(t, client.Config{
+		URL: url,
+		OnDisconnect: func(err error) {
+			disconnected <- err
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.Request(ctx, "kick", nil); !errors.Is(err, client.ErrDisconnected) {
+		t.Fatalf("request returned %v, want %v", err, client.ErrDisconnected)
+	}
+
+	select {
+	case err := <-disconnected:
+		if err == nil {
+			t.Fatal("lost connection was reported as closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnDisconnect wasn't called")
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("client without reconnect didn't stop")
+	}
+
+	if _, err := c.Request(ctx, "echo", nil); !errors.Is(err, client.ErrClosed) {
+		t.Fatalf("request after disconnect returned %v, want %v", err, client.ErrClosed)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	instance, url := newServer(t)
+	connected := make(chan struct{}, 10)
+	disconnected := make(chan error, 10)
+	c := connect(t, client.Config{
+		URL:        url,
+		Reconnect:  true,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		OnConnect: func(*client.Client) {
+			connected <- struct{}{}
+		},
+		OnDisconnect: func(err error) {
+			disconnected <- err
+		},
+	})
+
+	wait := func(channel <-chan struct{}, description string) {
+		t.Helper()
+		select {
+		case <-channel:
+		case <-time.After(time.Second):
+			t.Fatalf("client didn't %s", description)
+		}
+	}
+	wait(connected, "connect")
+
+	// Kick the session from the server
+	sessions := instance.GetSessions("alice")
+	if len(sessions) != 1 {
+		t.Fatalf("alice has %d sessions, want 1", len(sessions))
+	}
+	instance.DisconnectSession("alice", sessions[0])
+	select {
+	case err := <-disconnected:
+		if err == nil {
+			t.Fatal("lost connection was reported as closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnDisconnect wasn't called")
+	}
+	wait(connected, "reconnect")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	response, err := client.Request[echoAction](ctx, c, "echo", echoAction{Message: "back"})
+	if err != nil || response.Message != "back" {
+		t.Fatalf("request after reconnect returned %+v, %v", response, err)
+	}
+	if sessions := instance.GetSessions("alice"); len(sessions) != 1 {
+		t.Fatalf("alice has %d sessions after reconnecting, want 1", len(sessions))
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("close returned %s", err)
+	}
+	if err := <-disconnected; err != nil {
+		t.Fatalf("close was reported as %s", err)
+	}
+}
+
+func TestCloseWhileReconnecting(t *testing.T) {
+	instance, url := newServer(t)
+
+	// Only the first dial reaches the server, the others hang until they're cancelled
+	dials := &atomic.Int32{}
+	dialing := make(chan struct{}, 10)
+	dialer := &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if dials.Add(1) == 1 {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			}
+			dialing <- struct{}{}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		HandshakeTimeout: time.Minute,
+	}
+	c := connect(t, client.Config{
+		URL:        url,
+		Dialer:     dialer,
+		Reconnect:  true,
+		MinBackoff: time.Millisecond,
+	})
+
+	instance.DisconnectSession("alice", instance.GetSessions("alice")[0])
+	select {
+	case <-dialing:
+	case <-time.After(time.Second):
+		t.Fatal("client didn't reconnect")
+	}
+
+	// Close has to cancel the dial instead of waiting for the handshake timeout
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("close returned %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close waited for the dial")
+	}
+
+	if _, err := c.Send("echo", nil); !errors.Is(err, client.ErrClosed) {
+		t.Fatalf("send after close returned %v, want %v", err, client.ErrClosed)
+	}
+}
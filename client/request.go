@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+)
+
+// Returned by Request in case the gateway responded with an error response (success: false).
+type ResponseError struct {
+	Action  string
+	Message string
+}
+
+func (err *ResponseError) Error() string {
+	if err.Message == "" {
+		return "action " + err.Action + " failed"
+	}
+	return "action " + err.Action + " failed: " + err.Message
+}
+
+// Send an action to the gateway and decode the data of the response into R.
+//
+// Error responses created using neogate.ErrorResponse are returned as *ResponseError.
+func Request[R any](ctx context.Context, client *Client, action string, data any) (R, error) {
+	var response R
+
+	event, err := client.Request(ctx, action, data)
+	if err != nil {
+		return response, err
+	}
+
+	// Check if the gateway responded with an error
+	var status struct {
+		Success *bool  `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := event.Decode(&status); err == nil && status.Success != nil && !*status.Success {
+		return response, &ResponseError{
+			Action:  action,
+			Message: status.Message,
+		}
+	}
+
+	if err := event.Decode(&response); err != nil {
+		return response, err
+	}
+	return response, nil
+}
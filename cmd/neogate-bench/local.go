@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Liphium/neogate"
+	"github.com/gofiber/fiber/v2"
+)
+
+const localUserHeader = "X-Bench-User"
+
+// Start a gateway in this process that implements the actions used by the default mix. Returns the websocket url.
+func startLocalGateway() (string, error) {
+	var instance *neogate.Instance[neogate.None]
+	instance = neogate.Setup(neogate.Config[neogate.None]{
+		Handshake: func(req *neogate.HandshakeRequest) (neogate.SessionInfo[neogate.None], bool) {
+			userId := req.Get(localUserHeader)
+			return neogate.SessionInfo[neogate.None]{
+				UserId: userId,
+			}, userId != ""
+		},
+		SessionDisconnectHandler:   func(session *neogate.Session[neogate.None]) {},
+		SessionEnterNetworkHandler: func(session *neogate.Session[neogate.None], data neogate.None) bool { return false },
+		SessionAdapterHandler: func(userId, sessionId string) (string, string) {
+			return "user:" + userId, "session:" + sessionId
+		},
+		EncodingMiddleware: neogate.DefaultEncodingMiddleware[neogate.None],
+		DecodingMiddleware: neogate.DefaultDecodingMiddleware[neogate.None],
+		SharedEncoding:     true,
+	})
+	neogate.Log.SetOutput(discard{})
+	neogate.DebugLogs = false
+
+	// Responds with the data it received
+	neogate.CreateHandlerFor(instance, "echo", func(c *neogate.Context[neogate.None], data any) neogate.Event {
+		return neogate.NormalResponse(c, data)
+	})
+
+	// Sends the data to every connected user
+	neogate.CreateHandlerFor(instance, "broadcast", func(c *neogate.Context[neogate.None], data any) neogate.Event {
+		// Errors only happen for sessions that disconnected in the meantime, so they can be ignored
+		if _, err := instance.BroadcastAll(neogate.Event{Name: "bench:broadcast", Data: data}); err != nil {
+			return neogate.ErrorResponse(c, "Couldn't broadcast.", err)
+		}
+		return neogate.SuccessResponse(c)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	instance.MountGateway(app.Group("/ws"))
+	go app.Listener(listener)
+
+	return fmt.Sprintf("ws://%s/ws", listener.Addr().String()), nil
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
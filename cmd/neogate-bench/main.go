@@ -0,0 +1,259 @@
+// Command neogate-bench simulates lots of sessions to see how a neogate gateway holds up.
+//
+// Usage:
+//
+//	neogate-bench -local -clients 1000 -duration 30s
+//	neogate-bench -url ws://localhost:3000/ws -H "Authorization: Bearer {i}" -mix "ping=3,broadcast=1"
+//
+// Every client picks actions from the mix (action=weight) one after another and measures the time until
+// the response arrives. Events named like -broadcast-event are expected to carry {"sent_at": unix nanoseconds}
+// and are used to measure broadcast delivery. {i} in headers is replaced with the index of the client.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Liphium/neogate/client"
+)
+
+type headerFlags []string
+
+func (headers *headerFlags) String() string {
+	return strings.Join(*headers, ", ")
+}
+
+func (headers *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return errors.New("header should look like \"Key: Value\"")
+	}
+	*headers = append(*headers, value)
+	return nil
+}
+
+type weightedAction struct {
+	name   string
+	weight int
+}
+
+type options struct {
+	url            string
+	headers        headerFlags
+	clients        int
+	duration       time.Duration
+	ramp           time.Duration
+	rate           float64
+	timeout        time.Duration
+	payload        int
+	mix            []weightedAction
+	totalWeight    int
+	broadcastEvent string
+}
+
+type results struct {
+	connect    *recorder
+	actions    map[string]*recorder // Action -> response latency
+	broadcasts *recorder            // Delivery latency of broadcast events
+	errors     *errorCounter
+	requests   atomic.Int64
+}
+
+func main() {
+	opts := options{}
+	local := flag.Bool("local", false, "start a gateway in this process and benchmark it")
+	mix := flag.String("mix", "echo=9,broadcast=1", "actions to send with their weights (action=weight,...)")
+	flag.StringVar(&opts.url, "url", "", "websocket url of the gateway")
+	flag.Var(&opts.headers, "H", "header for the handshake (\"Key: Value\", {i} is replaced with the client index, can be repeated)")
+	flag.IntVar(&opts.clients, "clients", 100, "amount of concurrent clients")
+	flag.DurationVar(&opts.duration, "duration", 10*time.Second, "how long to send actions for")
+	flag.DurationVar(&opts.ramp, "ramp", time.Second, "time to spread the connects of all clients over")
+	flag.Float64Var(&opts.rate, "rate", 10, "actions per second per client (0 = as fast as possible)")
+	flag.DurationVar(&opts.timeout, "timeout", 5*time.Second, "how long to wait for a response")
+	flag.IntVar(&opts.payload, "payload", 64, "size of the payload sent with every action (in bytes)")
+	flag.StringVar(&opts.broadcastEvent, "broadcast-event", "bench:broadcast", "name of the event used to measure broadcast delivery")
+	flag.Parse()
+
+	var err error
+	if opts.mix, opts.totalWeight, err = parseMix(*mix); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid mix:", err)
+		os.Exit(1)
+	}
+
+	if *local {
+		if opts.url, err = startLocalGateway(); err != nil {
+			fmt.Fprintln(os.Stderr, "couldn't start local gateway:", err)
+			os.Exit(1)
+		}
+		if len(opts.headers) == 0 {
+			opts.headers = headerFlags{localUserHeader + ": user-{i}"}
+		}
+	}
+	if opts.url == "" {
+		fmt.Fprintln(os.Stderr, "either -url or -local is required")
+		os.Exit(1)
+	}
+
+	fmt.Printf("benchmarking %s with %d clients for %s\n", opts.url, opts.clients, opts.duration)
+	res := &results{
+		connect:    newRecorder(),
+		actions:    map[string]*recorder{},
+		broadcasts: newRecorder(),
+		errors:     newErrorCounter(),
+	}
+	for _, action := range opts.mix {
+		res.actions[action.name] = newRecorder()
+	}
+
+	start := time.Now()
+	run(opts, res)
+	report(opts, res, time.Since(start))
+
+	if res.errors.total() > 0 {
+		os.Exit(1)
+	}
+}
+
+func parseMix(mix string) ([]weightedAction, int, error) {
+	actions := []weightedAction{}
+	total := 0
+	for _, part := range strings.Split(mix, ",") {
+		name, rawWeight, found := strings.Cut(strings.TrimSpace(part), "=")
+		weight := 1
+		if found {
+			parsed, err := strconv.Atoi(rawWeight)
+			if err != nil || parsed <= 0 {
+				return nil, 0, fmt.Errorf("weight of %s should be a positive number", name)
+			}
+			weight = parsed
+		}
+		if name == "" {
+			return nil, 0, errors.New("action name is empty")
+		}
+
+		actions = append(actions, weightedAction{name: name, weight: weight})
+		total += weight
+	}
+	return actions, total, nil
+}
+
+func (opts options) pickAction() string {
+	n := rand.N(opts.totalWeight)
+	for _, action := range opts.mix {
+		if n < action.weight {
+			return action.name
+		}
+		n -= action.weight
+	}
+	return opts.mix[len(opts.mix)-1].name
+}
+
+func run(opts options, res *results) {
+	deadline := time.Now().Add(opts.ramp + opts.duration)
+	payload := strings.Repeat("x", opts.payload)
+	wg := &sync.WaitGroup{}
+
+	for i := range opts.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Spread out the connects over the ramp
+			if opts.clients > 1 {
+				time.Sleep(opts.ramp * time.Duration(i) / time.Duration(opts.clients))
+			}
+			runClient(opts, res, i, payload, deadline)
+		}()
+	}
+	wg.Wait()
+}
+
+func runClient(opts options, res *results, index int, payload string, deadline time.Time) {
+	header := http.Header{}
+	for _, value := range opts.headers {
+		key, value, _ := strings.Cut(strings.ReplaceAll(value, "{i}", strconv.Itoa(index)), ":")
+		header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	connectStart := time.Now()
+	c, err := client.Connect(ctx, client.Config{
+		URL:    opts.url,
+		Header: header,
+	})
+	cancel()
+	if err != nil {
+		res.errors.add("connect", err)
+		return
+	}
+	res.connect.add(time.Since(connectStart))
+	defer c.Close()
+
+	c.On(opts.broadcastEvent, func(event client.Event) {
+		var data struct {
+			SentAt int64 `json:"sent_at"`
+		}
+		if err := event.Decode(&data); err != nil || data.SentAt == 0 {
+			return
+		}
+		res.broadcasts.add(time.Since(time.Unix(0, data.SentAt)))
+	})
+
+	var interval time.Duration
+	if opts.rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.rate)
+	}
+
+	for next := time.Now(); time.Now().Before(deadline); next = next.Add(interval) {
+		if interval > 0 {
+			time.Sleep(time.Until(next))
+		}
+
+		action := opts.pickAction()
+		ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+		start := time.Now()
+		_, err := client.Request[any](ctx, c, action, map[string]any{
+			"sent_at": start.UnixNano(),
+			"payload": payload,
+		})
+		cancel()
+
+		res.requests.Add(1)
+		if err != nil {
+			res.errors.add(action, err)
+			if errors.Is(err, client.ErrClosed) {
+				return
+			}
+			continue
+		}
+		res.actions[action].add(time.Since(start))
+	}
+}
+
+func report(opts options, res *results, elapsed time.Duration) {
+	fmt.Println()
+	connect := res.connect.summarize()
+	fmt.Printf("connected       %d/%d  p50 %-10s p99 %-10s max %s\n", connect.count, opts.clients, connect.p50, connect.p99, connect.max)
+
+	requests := res.requests.Load()
+	fmt.Printf("requests        %d  (%.1f/s over %s)\n", requests, float64(requests)/elapsed.Seconds(), elapsed.Round(time.Millisecond))
+	for _, action := range opts.mix {
+		latency := res.actions[action.name].summarize()
+		fmt.Printf("  %-13s %d  p50 %-10s p99 %-10s max %s\n", action.name, latency.count, latency.p50, latency.p99, latency.max)
+	}
+
+	broadcasts := res.broadcasts.summarize()
+	fmt.Printf("broadcasts      %d deliveries  p50 %-10s p99 %-10s max %s\n", broadcasts.count, broadcasts.p50, broadcasts.p99, broadcasts.max)
+
+	fmt.Printf("errors          %d\n", res.errors.total())
+	fmt.Print(res.errors.String())
+}
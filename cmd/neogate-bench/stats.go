@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Collects durations to calculate percentiles at the end of the run.
+type recorder struct {
+	mutex     *sync.Mutex
+	durations []time.Duration
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		mutex:     &sync.Mutex{},
+		durations: []time.Duration{},
+	}
+}
+
+func (recorder *recorder) add(duration time.Duration) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.durations = append(recorder.durations, duration)
+}
+
+type summary struct {
+	count int
+	p50   time.Duration
+	p99   time.Duration
+	max   time.Duration
+}
+
+func (recorder *recorder) summarize() summary {
+	recorder.mutex.Lock()
+	durations := slices.Clone(recorder.durations)
+	recorder.mutex.Unlock()
+
+	if len(durations) == 0 {
+		return summary{}
+	}
+	slices.Sort(durations)
+	return summary{
+		count: len(durations),
+		p50:   percentile(durations, 0.50),
+		p99:   percentile(durations, 0.99),
+		max:   durations[len(durations)-1],
+	}
+}
+
+// Durations have to be sorted.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	index := int(float64(len(durations)-1) * p)
+	return durations[index]
+}
+
+// Counts errors by their message.
+type errorCounter struct {
+	mutex  *sync.Mutex
+	counts map[string]int
+}
+
+func newErrorCounter() *errorCounter {
+	return &errorCounter{
+		mutex:  &sync.Mutex{},
+		counts: map[string]int{},
+	}
+}
+
+func (counter *errorCounter) add(context string, err error) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	counter.counts[context+": "+err.Error()]++
+}
+
+func (counter *errorCounter) total() int {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	total := 0
+	for _, count := range counter.counts {
+		total += count
+	}
+	return total
+}
+
+func (counter *errorCounter) String() string {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	messages := make([]string, 0, len(counter.counts))
+	for message := range counter.counts {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return counter.counts[messages[i]] > counter.counts[messages[j]]
+	})
+
+	builder := &strings.Builder{}
+	for _, message := range messages {
+		fmt.Fprintf(builder, "  %6d  %s\n", counter.counts[message], message)
+	}
+	return builder.String()
+}
@@ -0,0 +1,204 @@
+// Command neogate-cli connects to a neogate gateway to send actions and look at the events it sends.
+//
+// Usage:
+//
+//	neogate-cli -url ws://localhost:3000/ws -H "Authorization: Bearer token"
+//	neogate-cli -url ws://localhost:3000/ws -script actions.txt
+//
+// Every line (in the REPL or script) is an action followed by its data as JSON, e.g. `ping {"value": 1}`.
+// Lines starting with # are ignored, ":sleep 1s" waits and ":quit" exits.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Liphium/neogate/client"
+)
+
+type headerFlags []string
+
+func (headers *headerFlags) String() string {
+	return strings.Join(*headers, ", ")
+}
+
+func (headers *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return errors.New("header should look like \"Key: Value\"")
+	}
+	*headers = append(*headers, value)
+	return nil
+}
+
+// Makes sure output from events and responses doesn't get mixed up
+var printMutex = &sync.Mutex{}
+
+func main() {
+	var headers headerFlags
+	url := flag.String("url", "ws://localhost:3000/ws", "websocket url of the gateway")
+	script := flag.String("script", "", "file with actions to run (one per line) instead of the REPL")
+	timeout := flag.Duration("timeout", 10*time.Second, "how long to wait for a response")
+	quiet := flag.Bool("quiet", false, "don't print events that aren't responses")
+	flag.Var(&headers, "H", "header for the handshake (\"Key: Value\", can be repeated)")
+	flag.Parse()
+
+	header := http.Header{}
+	for _, value := range headers {
+		key, value, _ := strings.Cut(value, ":")
+		header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+
+	c, err := client.Connect(context.Background(), client.Config{
+		URL:    *url,
+		Header: header,
+		OnDisconnect: func(err error) {
+			if err != nil {
+				printLine("disconnected: %s", err)
+			}
+		},
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "couldn't connect:", err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	if !*quiet {
+		c.OnAny(func(event client.Event) {
+			printLine("<- %s %s", event.Name, pretty(event.Data))
+		})
+	}
+
+	// Run the script in case there is one
+	if *script != "" {
+		file, err := os.Open(*script)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "couldn't open script:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		if err := run(c, file, *timeout, false); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	printLine("connected to %s, type an action and its data (e.g. ping {\"value\": 1}) or :quit", *url)
+	if err := run(c, os.Stdin, *timeout, true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Run all lines from the reader. Interactive mode doesn't wait for responses and keeps going on errors.
+func run(c *client.Client, reader io.Reader, timeout time.Duration, interactive bool) error {
+	scanner := bufio.NewScanner(reader)
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		select {
+		case <-c.Done():
+			return errors.New("connection closed")
+		default:
+		}
+
+		// Handle commands of the cli itself
+		if strings.HasPrefix(line, ":") {
+			command, arg, _ := strings.Cut(line[1:], " ")
+			switch command {
+			case "quit", "exit":
+				return nil
+			case "sleep":
+				duration, err := time.ParseDuration(strings.TrimSpace(arg))
+				if err != nil {
+					if !interactive {
+						return fmt.Errorf("line %d: %w", lineNumber, err)
+					}
+					printLine("invalid duration: %s", err)
+					continue
+				}
+				time.Sleep(duration)
+			default:
+				printLine("unknown command %s (available: :sleep <duration>, :quit)", command)
+			}
+			continue
+		}
+
+		action, rawData, _ := strings.Cut(line, " ")
+		var data any
+		if rawData = strings.TrimSpace(rawData); rawData != "" {
+			if !json.Valid([]byte(rawData)) {
+				if !interactive {
+					return fmt.Errorf("line %d: data of %s isn't valid json", lineNumber, action)
+				}
+				printLine("data isn't valid json")
+				continue
+			}
+			data = json.RawMessage(rawData)
+		}
+
+		// Don't block the REPL while waiting for the response
+		if interactive {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				request(c, action, data, timeout)
+			}()
+			continue
+		}
+		if err := request(c, action, data, timeout); err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func request(c *client.Client, action string, data any, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	printLine("-> %s", action)
+	start := time.Now()
+	response, err := c.Request(ctx, action, data)
+	if err != nil {
+		printLine("!! %s: %s", action, err)
+		return err
+	}
+
+	printLine("<- %s (%s) %s", response.Name, time.Since(start).Round(time.Microsecond), pretty(response.Data))
+	return nil
+}
+
+func pretty(data []byte) string {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return indented.String()
+}
+
+func printLine(format string, args ...any) {
+	printMutex.Lock()
+	defer printMutex.Unlock()
+
+	fmt.Printf(format+"\n", args...)
+}
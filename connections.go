@@ -12,7 +12,10 @@ func (instance *Instance[T]) RemoveSession(userId string, sessionId string) {
 	instance.DisconnectSession(userId, sessionId)
 
 	// Cleanup session
-	instance.connectionsCache.Delete(getKey(userId, sessionId))
+	if session, loaded := instance.connectionsCache.LoadAndDelete(getKey(userId, sessionId)); loaded {
+		instance.sessionCount.Add(-1)
+		instance.untagSession(session.(*Session[T]))
+	}
 	instance.removeSession(userId, sessionId)
 }
 
@@ -29,6 +32,10 @@ func (instance *Instance[T]) DisconnectSession(userId string, sessionId string)
 	session.wsMutex.Lock()
 	defer session.wsMutex.Unlock()
 
+	if session.closed {
+		return
+	}
+
 	// This is a little weird for disconnecting, but it works, so I'm not complaining
 	session.conn.SetReadDeadline(time.Now().Add(time.Microsecond * 1))
 	if err := session.conn.Close(); err != nil {
@@ -36,6 +43,29 @@ func (instance *Instance[T]) DisconnectSession(userId string, sessionId string)
 	}
 }
 
+// DisconnectSessionWithReason tells the client why it is disconnected (using a close message) and closes the session
+func (instance *Instance[T]) DisconnectSessionWithReason(userId string, sessionId string, reason string) {
+
+	// Get the session
+	session, valid := instance.Get(userId, sessionId)
+	if !valid {
+		instance.ReportGeneralError("session "+sessionId+" of user "+userId+" doesn't exist", errors.New("couldn't delete"))
+		return
+	}
+
+	session.wsMutex.Lock()
+	err := ErrSessionClosed
+	if !session.closed {
+		err = writeCloseReason(session.conn, reason)
+	}
+	session.wsMutex.Unlock()
+	if err != nil {
+		instance.ReportSessionError(session, "couldn't send close reason", err)
+	}
+
+	instance.DisconnectSession(userId, sessionId)
+}
+
 func (instance *Instance[T]) ExistsConnection(userId string, sessionId string) bool {
 	_, ok := instance.connectionsCache.Load(getKey(userId, sessionId))
 	if !ok {
@@ -54,6 +84,11 @@ func (instance *Instance[T]) Get(userId string, sessionId string) (*Session[T],
 	return session.(*Session[T]), true
 }
 
+// Amount of sessions connected to this instance
+func (instance *Instance[T]) SessionCount() int {
+	return int(instance.sessionCount.Load())
+}
+
 func (instance *Instance[T]) GetConnections(userId string) int {
 	sessionList, ok := instance.sessionsCache.sessions.Load(userId)
 	if !ok {
@@ -0,0 +1,141 @@
+package neogate
+
+import (
+	"errors"
+	"time"
+)
+
+// Action clients send to list the sessions of their user (response: {"success": true, "sessions": [...]}).
+const ListSessionsAction = "list_sessions"
+
+// Action clients send to sign out other sessions of their user
+// (data: {"session_id": "..."} or {"all_others": true}, response: {"success": true, "revoked": [...]}).
+const RevokeSessionsAction = "revoke_sessions"
+
+// Close reason for sessions revoked by another session of the user.
+const SessionRevokedCloseReason = "session revoked"
+
+// Config for the actions that let users manage their own sessions (ListSessionsAction and RevokeSessionsAction).
+type SessionActionsConfig[T any] struct {
+
+	// Label for the device of a session (default: the User-Agent header of the handshake request)
+	DeviceLabel func(session *Session[T]) string
+
+	// Called before sessions are revoked. Return true if the session is allowed to revoke the targets (everything is allowed in case it's nil).
+	AuthorizeRevoke func(session *Session[T], targets []string) bool
+
+	// Called after sessions were revoked (e.g. for an audit log).
+	OnRevoke func(session *Session[T], revoked []string)
+}
+
+// A session of the user as listed by ListSessionsAction.
+type ActiveSession struct {
+	SessionId   string `json:"session_id"`
+	Device      string `json:"device"`
+	IP          string `json:"ip"`
+	ConnectedAt int64  `json:"connected_at"` // Unix milliseconds
+	LastActive  int64  `json:"last_active"`  // Unix milliseconds
+	Current     bool   `json:"current"`      // If it's the session that sent the action
+}
+
+type listSessionsResponse struct {
+	Success  bool            `json:"success"`
+	Sessions []ActiveSession `json:"sessions"`
+}
+
+type revokeSessionsRequest struct {
+	SessionId string `json:"session_id"`
+	AllOthers bool   `json:"all_others"`
+}
+
+type revokeSessionsResponse struct {
+	Success bool     `json:"success"`
+	Revoked []string `json:"revoked"`
+}
+
+// Get the last time the session sent a message (or when it connected in case it didn't send any).
+func (session *Session[T]) GetLastActive() time.Time {
+	return time.Unix(0, session.lastActive.Load())
+}
+
+// List the sessions of the user (in the order they connected in).
+func (instance *Instance[T]) ListActiveSessions(userId string) []ActiveSession {
+	sessions := []ActiveSession{}
+	for _, sessionId := range instance.GetSessions(userId) {
+		session, ok := instance.Get(userId, sessionId)
+		if !ok {
+			continue
+		}
+
+		sessions = append(sessions, ActiveSession{
+			SessionId:   sessionId,
+			Device:      instance.deviceLabel(session),
+			IP:          session.metadata.RemoteAddr,
+			ConnectedAt: session.metadata.ConnectedAt.UnixMilli(),
+			LastActive:  session.GetLastActive().UnixMilli(),
+		})
+	}
+	return sessions
+}
+
+func (instance *Instance[T]) deviceLabel(session *Session[T]) string {
+	if config := instance.Config.SessionActions; config != nil && config.DeviceLabel != nil {
+		return config.DeviceLabel(session)
+	}
+	return session.metadata.UserAgent
+}
+
+// Register the actions for managing sessions (only in case Config.SessionActions is specified).
+func (instance *Instance[T]) registerSessionActions() {
+	config := instance.Config.SessionActions
+	if config == nil {
+		return
+	}
+
+	CreateHandlerFor(instance, ListSessionsAction, func(c *Context[T], data any) Event {
+		sessions := instance.ListActiveSessions(c.Session.userId)
+		for i := range sessions {
+			sessions[i].Current = sessions[i].SessionId == c.Session.sessionId
+		}
+
+		return Response(c, listSessionsResponse{
+			Success:  true,
+			Sessions: sessions,
+		})
+	})
+
+	CreateHandlerFor(instance, RevokeSessionsAction, func(c *Context[T], data revokeSessionsRequest) Event {
+		targets := []string{}
+		switch {
+		case data.AllOthers:
+			for _, sessionId := range instance.GetSessions(c.Session.userId) {
+				if sessionId != c.Session.sessionId {
+					targets = append(targets, sessionId)
+				}
+			}
+		case data.SessionId == c.Session.sessionId:
+			return ErrorResponse(c, "The current session can't be revoked.", nil)
+		case instance.ExistsConnection(c.Session.userId, data.SessionId):
+			targets = append(targets, data.SessionId)
+		default:
+			return ErrorResponse(c, "Session not found.", errors.New("session "+data.SessionId+" doesn't exist"))
+		}
+
+		if config.AuthorizeRevoke != nil && !config.AuthorizeRevoke(c.Session, targets) {
+			return ErrorResponse(c, "Not allowed to revoke sessions.", nil)
+		}
+
+		for _, sessionId := range targets {
+			Log.Println("session", sessionId, "of", c.Session.userId, "revoked by", c.Session.sessionId)
+			instance.DisconnectSessionWithReason(c.Session.userId, sessionId, SessionRevokedCloseReason)
+		}
+		if config.OnRevoke != nil {
+			config.OnRevoke(c.Session, targets)
+		}
+
+		return Response(c, revokeSessionsResponse{
+			Success: true,
+			Revoked: targets,
+		})
+	})
+}
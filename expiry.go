@@ -0,0 +1,97 @@
+package neogate
+
+import (
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// Action clients send to refresh their session before it expires (data is passed to Config.Reauthenticate).
+const ReauthAction = "reauth"
+
+// Name of the event that warns the client its session is about to expire (data: {"expires_at": unix milliseconds}).
+const SessionExpiringEvent = "session_expiring"
+
+// Close reason for sessions that weren't refreshed in time.
+const SessionExpiredCloseReason = "session expired"
+
+type sessionExpiringData struct {
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// Get the time the session expires at (zero in case it doesn't expire).
+func (session *Session[T]) GetExpiresAt() time.Time {
+	session.expiryMutex.Lock()
+	defer session.expiryMutex.Unlock()
+
+	return session.expiresAt
+}
+
+// Change when the session expires (zero = never) and reschedule the warning and disconnect.
+func (instance *Instance[T]) SetSessionExpiry(session *Session[T], expiresAt time.Time) {
+	session.expiryMutex.Lock()
+	defer session.expiryMutex.Unlock()
+
+	session.expiresAt = expiresAt
+	session.stopExpiryTimers()
+	if expiresAt.IsZero() {
+		return
+	}
+
+	warning := instance.Config.ExpiryWarning
+	if warning <= 0 {
+		warning = time.Minute
+	}
+
+	session.warnTimer = time.AfterFunc(max(time.Until(expiresAt.Add(-warning)), 0), func() {
+		if !instance.ExistsConnection(session.userId, session.sessionId) {
+			return
+		}
+
+		if err := instance.SendEventToSession(session, Event{
+			Name: SessionExpiringEvent,
+			Data: sessionExpiringData{ExpiresAt: expiresAt.UnixMilli()},
+		}); err != nil {
+			instance.ReportSessionError(session, "couldn't send expiry warning", err)
+		}
+	})
+	session.expireTimer = time.AfterFunc(time.Until(expiresAt), func() {
+		if !instance.ExistsConnection(session.userId, session.sessionId) {
+			return
+		}
+
+		Log.Println("session", session.sessionId, "of", session.userId, "expired")
+		instance.DisconnectSessionWithReason(session.userId, session.sessionId, SessionExpiredCloseReason)
+	})
+}
+
+// Needs the expiry mutex to be locked.
+func (session *Session[T]) stopExpiryTimers() {
+	if session.warnTimer != nil {
+		session.warnTimer.Stop()
+		session.warnTimer = nil
+	}
+	if session.expireTimer != nil {
+		session.expireTimer.Stop()
+		session.expireTimer = nil
+	}
+}
+
+// Register the action for refreshing sessions (only in case Config.Reauthenticate is specified).
+func (instance *Instance[T]) registerReauth() {
+	if instance.Config.Reauthenticate == nil {
+		return
+	}
+
+	CreateHandlerFor(instance, ReauthAction, func(c *Context[T], data sonic.NoCopyRawMessage) Event {
+		newData, expiresAt, ok := instance.Config.Reauthenticate(c.Session, data)
+		if !ok {
+			return ErrorResponse(c, "Re-authentication failed.", nil)
+		}
+
+		c.Session.SetData(newData)
+		instance.RetagSession(c.Session)
+		instance.SetSessionExpiry(c.Session, expiresAt)
+		return SuccessResponse(c)
+	})
+}
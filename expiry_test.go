@@ -0,0 +1,85 @@
+package neogate_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+	"github.com/Liphium/neogate/neogatetest"
+	"github.com/bytedance/sonic"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		reauth  string // Token sent with the reauth action after the warning (empty = no reauth)
+		success bool   // If the reauth action succeeds
+		expires bool   // If the session is disconnected because it expired
+	}{
+		{name: "expires", expires: true},
+		{name: "reauthenticated", reauth: "valid", success: true},
+		{name: "reauthentication failed", reauth: "invalid", expires: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			extended := time.Now().Add(time.Hour)
+			harness := newHarness(t, neogate.Config[neogate.None]{
+				Reauthenticate: func(session *neogate.Session[neogate.None], data []byte) (neogate.None, time.Time, bool) {
+					var token string
+					if err := sonic.Unmarshal(data, &token); err != nil || token != "valid" {
+						return neogate.None{}, time.Time{}, false
+					}
+					return neogate.None{}, extended, true
+				},
+				ExpiryWarning: 150 * time.Millisecond,
+			})
+
+			expiresAt := time.Now().Add(200 * time.Millisecond)
+			session := harness.ConnectInfo(t, neogate.SessionInfo[neogate.None]{UserId: "alice", ExpiresAt: expiresAt})
+			if got := session.GetExpiresAt(); !got.Equal(expiresAt) {
+				t.Fatalf("session expires at %s, want %s", got, expiresAt)
+			}
+
+			warning := session.ExpectEvent(t, neogate.SessionExpiringEvent)
+			data := neogatetest.Data[struct {
+				ExpiresAt int64 `json:"expires_at"`
+			}](t, warning)
+			if data.ExpiresAt != expiresAt.UnixMilli() {
+				t.Fatalf("warning says the session expires at %d, want %d", data.ExpiresAt, expiresAt.UnixMilli())
+			}
+
+			if test.reauth != "" {
+				response := session.ExpectResponse(t, session.Send(t, neogate.ReauthAction, test.reauth))
+				if result := neogatetest.Data[neogate.NormalResponseStruct](t, response); result.Success != test.success {
+					t.Fatalf("reauth response = %+v, want success %t", result, test.success)
+				}
+			}
+
+			if test.expires {
+				session.ExpectCloseReason(t, neogate.SessionExpiredCloseReason)
+				return
+			}
+
+			// Wait until after the old expiry
+			time.Sleep(time.Until(expiresAt) + 50*time.Millisecond)
+			if session.Conn.IsClosed() {
+				t.Fatal("reauthenticated session was disconnected")
+			}
+			if got := session.GetExpiresAt(); !got.Equal(extended) {
+				t.Fatalf("session expires at %s, want %s", got, extended)
+			}
+		})
+	}
+}
+
+func TestSessionExpiryRemoved(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{})
+	session := harness.ConnectInfo(t, neogate.SessionInfo[neogate.None]{UserId: "alice", ExpiresAt: time.Now().Add(50 * time.Millisecond)})
+
+	harness.Instance.SetSessionExpiry(session.Session, time.Time{})
+	time.Sleep(100 * time.Millisecond)
+	if session.Conn.IsClosed() {
+		t.Fatal("session without expiry was disconnected")
+	}
+}
@@ -0,0 +1,12 @@
+package neogate
+
+import "io"
+
+// Internals used by the tests in neogate_test.
+
+var (
+	WriteSSE             = writeSSE
+	WriteFallbackMessage = func(w io.Writer, messageType int, data []byte) error {
+		return writeFallbackMessage(w, fallbackMessage{messageType: messageType, data: data})
+	}
+)
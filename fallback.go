@@ -0,0 +1,243 @@
+package neogate
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fasthttp/websocket"
+)
+
+// Header the client has to send the token of its session in when posting actions to the fallback transport.
+const FallbackTokenHeader = "X-Neogate-Token"
+
+var (
+	errFallbackClosed  = errors.New("fallback connection closed")
+	errFallbackTimeout = errors.New("fallback read timed out")
+)
+
+// Time between keep alive comments on the event stream (so proxies don't close it).
+var fallbackKeepAlive = 15 * time.Second
+
+// How long posting an action waits for the session to read it.
+var fallbackPostTimeout = 10 * time.Second
+
+type fallbackMessage struct {
+	messageType int
+	data        []byte
+}
+
+// Conn for the fallback transport: messages to the client are streamed using server-sent events,
+// messages from the client are posted over http.
+type fallbackConn struct {
+	token     string
+	inbound   chan []byte
+	outbound  chan fallbackMessage
+	closed    chan struct{}
+	closeOnce *sync.Once
+	onClose   func()
+
+	deadlineMutex *sync.Mutex
+	deadline      time.Time
+}
+
+func newFallbackConn(token string, onClose func()) *fallbackConn {
+	return &fallbackConn{
+		token:         token,
+		inbound:       make(chan []byte),
+		outbound:      make(chan fallbackMessage, 64),
+		closed:        make(chan struct{}),
+		closeOnce:     &sync.Once{},
+		onClose:       onClose,
+		deadlineMutex: &sync.Mutex{},
+	}
+}
+
+func (conn *fallbackConn) ReadMessage() (int, []byte, error) {
+	conn.deadlineMutex.Lock()
+	deadline := conn.deadline
+	conn.deadlineMutex.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case msg := <-conn.inbound:
+		return websocket.TextMessage, msg, nil
+	case <-conn.closed:
+		return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	case <-timeout:
+		return 0, nil, errFallbackTimeout
+	}
+}
+
+func (conn *fallbackConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case conn.outbound <- fallbackMessage{messageType: messageType, data: data}:
+		return nil
+	case <-conn.closed:
+		return errFallbackClosed
+	}
+}
+
+// Only applies to the next read (closing the connection is what actually stops a read in progress).
+func (conn *fallbackConn) SetReadDeadline(t time.Time) error {
+	conn.deadlineMutex.Lock()
+	defer conn.deadlineMutex.Unlock()
+
+	conn.deadline = t
+	return nil
+}
+
+func (conn *fallbackConn) Close() error {
+	conn.closeOnce.Do(func() {
+		close(conn.closed)
+		conn.onClose()
+	})
+	return nil
+}
+
+// Pass a message posted by the client to the session.
+func (conn *fallbackConn) post(msg []byte) error {
+	select {
+	case conn.inbound <- msg:
+		return nil
+	case <-conn.closed:
+		return errFallbackClosed
+	case <-time.After(fallbackPostTimeout):
+		return errFallbackTimeout
+	}
+}
+
+// Stream messages to the client until the connection is closed or done is closed (client went away).
+func (conn *fallbackConn) stream(w io.Writer, flush func() error, done <-chan struct{}) {
+	defer conn.Close()
+
+	// Tell the client the token it needs to post actions
+	if writeSSE(w, "session", []byte(fmt.Sprintf(`{"token":"%s"}`, conn.token))) != nil || flush() != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(fallbackKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case msg := <-conn.outbound:
+			err = writeFallbackMessage(w, msg)
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		case <-done:
+			return
+		case <-conn.closed:
+
+			// Send whatever is still queued (e.g. a close message)
+			for {
+				select {
+				case msg := <-conn.outbound:
+					if writeFallbackMessage(w, msg) != nil {
+						return
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Returns errFallbackClosed for close messages so the stream stops after sending them.
+func writeFallbackMessage(w io.Writer, msg fallbackMessage) error {
+	switch msg.messageType {
+	case websocket.TextMessage, websocket.BinaryMessage:
+
+		// Server-sent events can only carry text
+		if !utf8.Valid(msg.data) {
+			return writeSSE(w, "binary", []byte(base64.StdEncoding.EncodeToString(msg.data)))
+		}
+		return writeSSE(w, "", msg.data)
+	case websocket.CloseMessage:
+		reason := ""
+		if len(msg.data) > 2 {
+			reason = string(msg.data[2:])
+		}
+		if err := writeSSE(w, "close", []byte(reason)); err != nil {
+			return err
+		}
+		return errFallbackClosed
+	}
+	return nil
+}
+
+// Write a server-sent event (empty event name = default message event).
+func writeSSE(w io.Writer, event string, data []byte) error {
+	builder := &strings.Builder{}
+	if event != "" {
+		builder.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		builder.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	builder.WriteString("\n")
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// Check if the request should be handled by the fallback transport.
+func isFallbackRequest(method string, accept string) bool {
+	return (method == http.MethodGet && strings.Contains(accept, "text/event-stream")) || method == http.MethodPost
+}
+
+// Run the handshake for a client that wants to use the fallback transport and start the session.
+// The returned connection has to be streamed to the client.
+func (instance *Instance[T]) openFallback(req *HandshakeRequest) (*fallbackConn, *HandshakeError) {
+	info, handshakeErr := instance.Accept(req)
+	if handshakeErr != nil {
+		return nil, handshakeErr
+	}
+
+	token := GenerateToken(32)
+	conn := newFallbackConn(token, func() {
+		instance.fallbackConns.Delete(token)
+	})
+	instance.fallbackConns.Store(token, conn)
+
+	go instance.Run(conn, info)
+	return conn, nil
+}
+
+// Pass an action posted by the client to its session. Returns the http status for the response.
+func (instance *Instance[T]) postFallback(token string, body []byte) int {
+	obj, ok := instance.fallbackConns.Load(token)
+	if !ok {
+		return http.StatusNotFound
+	}
+
+	if err := obj.(*fallbackConn).post(body); err != nil {
+		if errors.Is(err, errFallbackTimeout) {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusGone
+	}
+	return http.StatusNoContent
+}
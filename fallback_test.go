@@ -0,0 +1,67 @@
+package neogate_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Liphium/neogate"
+	"github.com/fasthttp/websocket"
+)
+
+func TestWriteSSE(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+		data  string
+		want  string
+	}{
+		{"message", "", `{"name":"hello"}`, "data: {\"name\":\"hello\"}\n\n"},
+		{"named event", "session", `{"token":"abc"}`, "event: session\ndata: {\"token\":\"abc\"}\n\n"},
+		{"empty data", "close", "", "event: close\ndata: \n\n"},
+		{"multiple lines", "", "a\nb\nc", "data: a\ndata: b\ndata: c\n\n"},
+		{"carriage returns", "", "a\r\nb", "data: a\ndata: b\n\n"},
+		{"trailing newline", "", "a\n", "data: a\ndata: \n\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := &strings.Builder{}
+			if err := neogate.WriteSSE(builder, test.event, []byte(test.data)); err != nil {
+				t.Fatalf("couldn't write event: %s", err)
+			}
+			if got := builder.String(); got != test.want {
+				t.Fatalf("framed as %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWriteFallbackMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageType int
+		data        []byte
+		want        string
+		closed      bool // If the stream should stop after the message
+	}{
+		{"text", websocket.TextMessage, []byte(`{"name":"hello"}`), "data: {\"name\":\"hello\"}\n\n", false},
+		{"binary json", websocket.BinaryMessage, []byte(`{"name":"hello"}`), "data: {\"name\":\"hello\"}\n\n", false},
+		{"binary", websocket.BinaryMessage, []byte{0xff, 0x00, 0x01}, "event: binary\ndata: /wAB\n\n", false},
+		{"close", websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked"), "event: close\ndata: session revoked\n\n", true},
+		{"close without reason", websocket.CloseMessage, nil, "event: close\ndata: \n\n", true},
+		{"ping", websocket.PingMessage, []byte("ping"), "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := &strings.Builder{}
+			err := neogate.WriteFallbackMessage(builder, test.messageType, test.data)
+			if closed := err != nil; closed != test.closed {
+				t.Fatalf("stream closed = %t (%v), want %t", closed, err, test.closed)
+			}
+			if got := builder.String(); got != test.want {
+				t.Fatalf("framed as %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -1,130 +1,143 @@
 package neogate
 
 import (
+	"errors"
 	"fmt"
-	"runtime/debug"
 	"strings"
 	"time"
 
 	"github.com/bytedance/sonic"
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/websocket/v2"
+	"github.com/fasthttp/websocket"
 )
 
-// Mount the neogate gateway using a fiber router.
-func (instance *Instance[T]) MountGateway(router fiber.Router) {
-
-	// Inject a middleware to check if the request is a websocket upgrade request
-	router.Use("/", func(c *fiber.Ctx) error {
+// Create a unique session id for a new session of the user.
+func (instance *Instance[T]) newSessionId(userId string) string {
+	sessionId := GenerateToken(16)
+	for instance.ExistsConnection(userId, sessionId) {
+		sessionId = GenerateToken(16)
+	}
+	return sessionId
+}
 
-		// Check if it is a websocket upgrade request
-		if websocket.IsWebSocketUpgrade(c) {
-			info, ok := instance.Config.Handshake(c)
-			if !ok {
-				Log.Println("closed connection: invalid auth token")
-				return c.SendStatus(fiber.StatusBadRequest)
-			}
+// Open registers a session for a connection that already passed the handshake and calls the enter network handler.
+//
+// Returns false in case the session should be disconnected (it has already been cleaned up then).
+// Run does this for you, only use it in case you manage the connection yourself.
+func (instance *Instance[T]) Open(conn Conn, info SessionInfo[T]) (session *Session[T], ok bool) {
+	if info.sessionId == "" {
+		info.sessionId = instance.newSessionId(info.UserId)
+	}
 
-			// Create a unique session id to identify this specific session
-			currentSession := GenerateToken(16)
-			for instance.ExistsConnection(info.UserId, currentSession) {
-				currentSession = GenerateToken(16)
-			}
-			info.sessionId = currentSession
+	session = info.toSession(conn)
 
-			c.Locals("info", info)
+	defer func() {
 
-			return c.Next()
+		// Recover from a failure (in case of a cast issue maybe?)
+		if err := recover(); err != nil {
+			Log.Println("connection with", info.UserId, "crashed cause of:", err)
+			instance.closeSession(session)
+			ok = false
 		}
+	}()
 
-		return c.SendStatus(fiber.StatusUpgradeRequired)
-	})
+	if !instance.enter(session, info.authenticated) {
+		writeCloseReason(conn, SessionLimitCloseReason)
+		session.slot.release()
+		return nil, false
+	}
+
+	instance.SetSessionExpiry(session, info.ExpiresAt)
+	instance.RetagSession(session)
+
+	if instance.Config.SessionEnterNetworkHandler(session, info.Data) {
+		instance.closeSession(session)
+		return nil, false
+	}
 
-	// Mount an endpoint for actually receiving the websocket connection
-	router.Get("/", websocket.New(func(c *websocket.Conn) {
-		ws(c, instance)
-	}))
+	return session, true
 }
 
-// Handles the websocket connection
-func ws[T any](conn *websocket.Conn, instance *Instance[T]) {
-	deferFunc := func() {
-		if err := recover(); err != nil {
-			Log.Println("There was an error with a connection: ", err)
-			debug.PrintStack()
+// Add the session (and the user adapter in case it's the first session of the user). This happens with the user locked,
+// so concurrent connections can't exceed the session limit and the outbox is delivered before any new events.
+//
+// Returns false in case the user already has the maximum amount of sessions.
+func (instance *Instance[T]) enter(session *Session[T], authenticated bool) bool {
+	unlock := instance.lockUser(session.userId)
+	defer unlock()
+
+	if instance.sessionLimitReached(session.userId) {
+		Log.Println("closed connection: session limit reached for", session.userId)
+		return false
+	}
+	first := instance.GetConnections(session.userId) == 0
+
+	// Tell the client the first message authenticated it
+	if authenticated {
+		if err := instance.SendEventToSession(session, Event{Name: AuthenticatedEvent, Data: NormalResponseStruct{Success: true}}); err != nil {
+			instance.ReportSessionError(session, "couldn't send authenticated event", err)
 		}
+	}
 
-		// Close the connection
-		conn.Close()
+	// Deliver the events sent while the user was offline (nothing can be sent to the user until it's unlocked)
+	if first && instance.Config.Outbox != nil {
+		instance.deliverOutbox(session)
 	}
 
-	defer func() {
-		deferFunc()
-	}()
+	instance.addSession(session)
 
-	// Get info from handshake in upgrade request
-	info := conn.Locals("info").(SessionInfo[T])
+	// Add adapter for pipes (if this is the first session)
+	if first {
+		instance.addUserAdapter(session)
+	}
+	return true
+}
 
-	// Make sure there is an infinite read timeout again (1 week should be enough)
-	conn.SetReadDeadline(time.Now().Add(time.Hour * 24 * 7))
+func (instance *Instance[T]) addUserAdapter(session *Session[T]) {
+	userId := session.userId
+	userAdapterName, _ := instance.Config.SessionAdapterHandler(userId, session.sessionId)
+	_, err := instance.Adapt(CreateAction{
+		ID:        userAdapterName,
+		Metadata:  session.metadata,
+		OwnerUser: userId,
+		internal:  true,
+		OnEvent: func(c *AdapterContext) error {
+			if err := instance.SendEventToUser(userId, *c.Event); err != nil {
+				instance.ReportSessionError(session, "couldn't send received message", err)
+				return err
+			}
+			return nil
+		},
 
-	session := info.toSession(conn)
-	instance.addSession(session)
+		// Disconnect the user on error
+		OnError: func(err error) {
+			instance.RemoveAdapter(userAdapterName)
+		},
+	})
+	if err != nil {
+		instance.ReportSessionError(session, "couldn't register user adapter", err)
+	}
+}
 
-	deferFunc = func() {
+// Serve reads messages from the connection of the session until it's closed. The session is removed afterwards.
+//
+// Run does this for you, only use it in case you manage the connection yourself.
+func (instance *Instance[T]) Serve(session *Session[T]) {
+	defer func() {
 
 		// Recover from a failure (in case of a cast issue maybe?)
 		if err := recover(); err != nil {
-			Log.Println("connection with", info.UserId, "crashed cause of:", err)
-		}
-
-		// Get the session
-		session, valid := instance.Get(info.UserId, info.sessionId)
-		if !valid {
-			return
+			Log.Println("connection with", session.userId, "crashed cause of:", err)
 		}
 
-		// Remove the connection from the cache
-		instance.Config.SessionDisconnectHandler(session)
-		instance.RemoveSession(session.userId, session.sessionId)
-
-		// Only remove adapter if all sessions are gone
-		if len(instance.GetSessions(session.userId)) == 0 {
-			instance.RemoveAdapter(session.userId)
-		}
-	}
-
-	// Add adapter for pipes (if this is the first session)
-	if len(instance.GetSessions(info.UserId)) == 1 {
-		userAdapterName, _ := instance.Config.SessionAdapterHandler(session.GetUserId(), session.GetSessionId())
-		instance.Adapt(CreateAction{
-			ID: userAdapterName,
-			OnEvent: func(c *AdapterContext) error {
-				if err := instance.SendEventToUser(info.UserId, *c.Event); err != nil {
-					instance.ReportSessionError(session, "couldn't send received message", err)
-					return err
-				}
-				return nil
-			},
-
-			// Disconnect the user on error
-			OnError: func(err error) {
-				instance.RemoveAdapter(userAdapterName)
-			},
-		})
-	}
-
-	if instance.Config.SessionEnterNetworkHandler(session, info.Data) {
-		return
-	}
+		instance.closeSession(session)
+	}()
 
 	for {
-		_, msg, err := conn.ReadMessage()
+		_, msg, err := session.conn.ReadMessage()
 
-		// Get the session
-		session, valid := instance.Get(info.UserId, info.sessionId)
-		if !valid {
-			instance.ReportGeneralError("couldn't get session", fmt.Errorf("%s (%s)", info.UserId, info.sessionId))
+		// Make sure the session still exists
+		if !instance.ExistsConnection(session.userId, session.sessionId) {
+			instance.ReportGeneralError("couldn't get session", fmt.Errorf("%s (%s)", session.userId, session.sessionId))
 			return
 		}
 		if err != nil {
@@ -137,45 +150,86 @@ func ws[T any](conn *websocket.Conn, instance *Instance[T]) {
 			return
 		}
 
-		// Decode the message
-		message, err := instance.Config.DecodingMiddleware(session, instance, msg)
-		if err != nil {
-			instance.ReportSessionError(session, "couldn't decode message", err)
+		if err := instance.Receive(session, msg); err != nil {
+			instance.ReportSessionError(session, "couldn't receive message", err)
 			return
 		}
+	}
+}
 
-		// Unmarshal the message to extract a few things
-		var body map[string]any
-		if err := sonic.Unmarshal(message, &body); err != nil {
-			return
-		}
+// Receive handles a message sent by the session (decoding, parsing of the action and routing to the handler).
+//
+// Returns an error in case the message is invalid, the session should be disconnected then.
+func (instance *Instance[T]) Receive(session *Session[T], msg []byte) error {
+	session.lastActive.Store(time.Now().UnixNano())
 
-		// Extract the response id and action from the message
-		actionString, ok := body["action"].(string)
-		if !ok {
-			instance.ReportSessionError(session, "missing string field action", nil)
-			return
-		}
-		args := strings.Split(actionString, ":")
-		if len(args) != 2 {
-			instance.ReportSessionError(session, "action field should consist of action:responseId", nil)
-			return
-		}
-		action := args[0]
-		responseId := args[1]
-
-		ctx := &Context[T]{
-			Session:    session,
-			Data:       message,
-			Action:     action,
-			ResponseId: responseId,
-			Instance:   instance,
-		}
+	// Decode the message
+	message, err := instance.Config.DecodingMiddleware(session, instance, msg)
+	if err != nil {
+		return fmt.Errorf("couldn't decode message: %w", err)
+	}
 
-		// Handle the action
-		if !instance.Handle(ctx) {
-			instance.ReportSessionError(session, "couldn't handle action", fmt.Errorf("action=%s, response_id=%s", action, responseId))
-			return
-		}
+	// Unmarshal the message to extract a few things
+	var body map[string]any
+	if err := sonic.Unmarshal(message, &body); err != nil {
+		return fmt.Errorf("couldn't parse message: %w", err)
+	}
+
+	// Extract the response id and action from the message
+	actionString, ok := body["action"].(string)
+	if !ok {
+		return errors.New("missing string field action")
+	}
+	args := strings.Split(actionString, ":")
+	if len(args) != 2 {
+		return errors.New("action field should consist of action:responseId")
+	}
+	action := args[0]
+	responseId := args[1]
+
+	ctx := &Context[T]{
+		Session:    session,
+		Data:       message,
+		Action:     action,
+		ResponseId: responseId,
+		Instance:   instance,
+	}
+
+	// Handle the action
+	if !instance.Handle(ctx) {
+		return fmt.Errorf("couldn't handle action: action=%s, response_id=%s", action, responseId)
+	}
+	return nil
+}
+
+// Remove a session that was disconnected (and the user adapter in case it was the last session).
+func (instance *Instance[T]) closeSession(session *Session[T]) {
+
+	// Writers that got the session before it was removed must not use the connection anymore
+	defer func() {
+		session.wsMutex.Lock()
+		session.closed = true
+		session.wsMutex.Unlock()
+		session.slot.release()
+	}()
+
+	// Make sure the session wasn't already removed
+	if !instance.ExistsConnection(session.userId, session.sessionId) {
+		return
+	}
+
+	// Make sure the expiry doesn't fire for a session that's already gone
+	instance.SetSessionExpiry(session, time.Time{})
+
+	// Remove the connection from the cache
+	instance.Config.SessionDisconnectHandler(session)
+	unlock := instance.lockUser(session.userId)
+	defer unlock()
+	instance.RemoveSession(session.userId, session.sessionId)
+
+	// Only remove adapter if all sessions are gone
+	if len(instance.GetSessions(session.userId)) == 0 {
+		userAdapterName, _ := instance.Config.SessionAdapterHandler(session.userId, session.sessionId)
+		instance.RemoveAdapter(userAdapterName)
 	}
 }
@@ -0,0 +1,265 @@
+package neogate
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// Keeps the last events sent to the adapters matching the pattern (see MatchAdapters for the syntax).
+type HistoryConfig struct {
+	Pattern   string
+	MaxEvents int           // Maximum amount of events kept per adapter (0 = unlimited in case MaxAge is specified, 100 otherwise)
+	MaxAge    time.Duration // How long events are kept (0 = forever)
+}
+
+// Amount of events kept by histories that don't specify any limits.
+var defaultHistoryEvents = 100
+
+// An event in the history of an adapter.
+type HistoryEntry struct {
+	Message []byte    // The event as json (stored like it was sent, so later changes to its data don't change the history)
+	Time    time.Time // When the event was sent
+}
+
+// Storage for the history of adapters (NewMemoryHistoryStore is used by default).
+type HistoryStore interface {
+
+	// Add an event to the history of the adapter and drop the events exceeding the limits of the config.
+	Append(adapterId string, entry HistoryEntry, config HistoryConfig) error
+
+	// Get the history of the adapter (oldest first) without the events exceeding the limits of the config.
+	Load(adapterId string, config HistoryConfig) ([]HistoryEntry, error)
+}
+
+// How often the memory store removes the histories that only contain expired events.
+var historySweepInterval = time.Minute
+
+// Amount of histories kept by NewMemoryHistoryStore.
+var defaultMaxHistories = 10_000
+
+type memoryHistoryStore struct {
+	mutex        *sync.Mutex
+	histories    map[string]*list.Element // AdapterId -> element of the history in recent
+	recent       *list.List               // Histories ordered by when they were last used (most recent first)
+	maxHistories int
+	lastSweep    time.Time
+}
+
+type memoryHistory struct {
+	adapterId string
+	config    HistoryConfig
+	entries   []HistoryEntry
+}
+
+// Create a history store that keeps the events in memory (at most 10000 histories, see NewMemoryHistoryStoreWithLimit).
+func NewMemoryHistoryStore() HistoryStore {
+	return NewMemoryHistoryStoreWithLimit(defaultMaxHistories)
+}
+
+// Create a history store that keeps the events in memory. In case there are more than maxHistories adapters
+// with a history, the history that wasn't used for the longest time is dropped (0 = unlimited).
+func NewMemoryHistoryStoreWithLimit(maxHistories int) HistoryStore {
+	return &memoryHistoryStore{
+		mutex:        &sync.Mutex{},
+		histories:    map[string]*list.Element{},
+		recent:       list.New(),
+		maxHistories: maxHistories,
+		lastSweep:    time.Now(),
+	}
+}
+
+func (store *memoryHistoryStore) Append(adapterId string, entry HistoryEntry, config HistoryConfig) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Remove the histories that only contain expired events
+	if time.Since(store.lastSweep) > historySweepInterval {
+		for _, element := range store.histories {
+			history := element.Value.(*memoryHistory)
+			if history.trim(); len(history.entries) == 0 {
+				store.remove(element)
+			}
+		}
+		store.lastSweep = time.Now()
+	}
+
+	element, ok := store.histories[adapterId]
+	if !ok {
+		element = store.recent.PushFront(&memoryHistory{adapterId: adapterId})
+		store.histories[adapterId] = element
+
+		// Drop the least recently used history in case there are too many
+		if store.maxHistories > 0 && store.recent.Len() > store.maxHistories {
+			store.remove(store.recent.Back())
+		}
+	}
+	store.recent.MoveToFront(element)
+
+	history := element.Value.(*memoryHistory)
+	history.config = config
+	history.entries = append(history.entries, entry)
+	history.trim()
+	return nil
+}
+
+func (store *memoryHistoryStore) Load(adapterId string, config HistoryConfig) ([]HistoryEntry, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	element, ok := store.histories[adapterId]
+	if !ok {
+		return []HistoryEntry{}, nil
+	}
+	store.recent.MoveToFront(element)
+
+	history := element.Value.(*memoryHistory)
+	history.config = config
+	history.trim()
+	return append([]HistoryEntry{}, history.entries...), nil
+}
+
+// Drop the history (needs the mutex to be locked).
+func (store *memoryHistoryStore) remove(element *list.Element) {
+	store.recent.Remove(element)
+	delete(store.histories, element.Value.(*memoryHistory).adapterId)
+}
+
+// Drop the events exceeding the limits.
+func (history *memoryHistory) trim() {
+	if history.config.MaxAge > 0 {
+		cutoff := time.Now().Add(-history.config.MaxAge)
+		expired := 0
+		for expired < len(history.entries) && history.entries[expired].Time.Before(cutoff) {
+			expired++
+		}
+		history.entries = history.entries[expired:]
+	}
+	if max := history.config.MaxEvents; max > 0 && len(history.entries) > max {
+		history.entries = history.entries[len(history.entries)-max:]
+	}
+}
+
+// Get the history config for the adapter (the first one in Config.History matching it).
+func (instance *Instance[T]) historyConfig(adapterId string) (HistoryConfig, bool) {
+	for _, config := range instance.Config.History {
+		if matchAdapterPattern(config.Pattern, adapterId) {
+			if config.MaxEvents <= 0 && config.MaxAge <= 0 {
+				config.MaxEvents = defaultHistoryEvents
+			}
+			return config, true
+		}
+	}
+	return HistoryConfig{}, false
+}
+
+// Add the marshaled event to the history of the adapter (in case it has one) and pass it to the adapter.
+//
+// Adapters registered using CreateAction.Replay get events sent while they're registered either from the history
+// or directly, never both.
+func (instance *Instance[T]) recordAndReceive(adapterId string, event Event, msg []byte) error {
+	config, ok := instance.historyConfig(adapterId)
+	if !ok {
+		return instance.AdapterReceive(adapterId, event, msg)
+	}
+
+	// Copied since the message is also passed to the adapters
+	instance.historyMutex.RLock()
+	entry := HistoryEntry{Message: slices.Clone(msg), Time: time.Now()}
+	if err := instance.historyStore.Append(adapterId, entry, config); err != nil {
+		instance.ReportGeneralError("couldn't add event to history of "+adapterId, err)
+	}
+	obj, ok := instance.adapters.Load(adapterId)
+	instance.historyMutex.RUnlock()
+
+	if !ok {
+		return ErrAdapterNotFound
+	}
+	return instance.receiveEntry(obj.(*adapterEntry), event, msg)
+}
+
+// Get the events in the history of the adapter (oldest first, empty in case it doesn't have a history).
+//
+// The data of the events is decoded from json (e.g. structs are maps).
+func (instance *Instance[T]) GetHistory(adapterId string) ([]Event, error) {
+	entries, err := instance.loadHistory(adapterId)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		var event Event
+		if err := sonic.Unmarshal(entry.Message, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (instance *Instance[T]) loadHistory(adapterId string) ([]HistoryEntry, error) {
+	config, ok := instance.historyConfig(adapterId)
+	if !ok {
+		return []HistoryEntry{}, nil
+	}
+	return instance.historyStore.Load(adapterId, config)
+}
+
+// Register the adapter and pass its history to it before any other event.
+func (instance *Instance[T]) adaptWithReplay(createAction CreateAction) (*Subscription, error) {
+
+	// Events can't be recorded between registering the adapter and loading the history
+	instance.historyMutex.Lock()
+	subscription, created, err := instance.register(createAction)
+	if err != nil || !created {
+		instance.historyMutex.Unlock()
+		return subscription, err
+	}
+	entries, err := instance.loadHistory(createAction.ID)
+	instance.historyMutex.Unlock()
+
+	// The adapter is still locked, so events sent in the meantime are delivered after the history
+	defer subscription.Adapter.Mutex.Unlock()
+	if err != nil {
+		instance.ReportGeneralError("couldn't load history of "+createAction.ID, err)
+		return subscription, nil
+	}
+	instance.replayHistory(subscription.Adapter, entries)
+	return subscription, nil
+}
+
+// Pass the entries of the history to the adapter (needs the mutex of the adapter to be locked).
+func (instance *Instance[T]) replayHistory(adapter *Adapter, entries []HistoryEntry) {
+
+	for _, entry := range entries {
+		var event Event
+		if err := sonic.Unmarshal(entry.Message, &event); err != nil {
+			instance.ReportGeneralError("couldn't replay history of "+adapter.ID, err)
+			return
+		}
+
+		// Stop in case the adapter failed (it probably removed itself)
+		if adapter.deliverLocked(event, entry.Message) != nil {
+			return
+		}
+	}
+}
+
+// Send the history of the adapter to the session (e.g. when it joins a room without registering its own adapter).
+func (instance *Instance[T]) ReplayHistoryToSession(session *Session[T], adapterId string) error {
+	entries, err := instance.loadHistory(adapterId)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := instance.sendToSessionWS(session, entry.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
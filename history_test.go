@@ -0,0 +1,162 @@
+package neogate_test
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+)
+
+// Get the names of the events.
+func eventNames(events []neogate.Event) []string {
+	names := []string{}
+	for _, event := range events {
+		names = append(names, event.Name)
+	}
+	return names
+}
+
+func TestGetHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  neogate.HistoryConfig
+		sent    int           // Amount of events sent to the adapter
+		wait    time.Duration // Time waited before the last event is sent
+		history []string
+	}{
+		{name: "all", config: neogate.HistoryConfig{Pattern: "room:*"}, sent: 3, history: []string{"0", "1", "2"}},
+		{name: "max events", config: neogate.HistoryConfig{Pattern: "room:*", MaxEvents: 2}, sent: 3, history: []string{"1", "2"}},
+		{name: "max age", config: neogate.HistoryConfig{Pattern: "room:*", MaxAge: 50 * time.Millisecond}, sent: 3, wait: 100 * time.Millisecond, history: []string{"2"}},
+		{name: "no match", config: neogate.HistoryConfig{Pattern: "lobby:*"}, sent: 3, history: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{History: []neogate.HistoryConfig{test.config}})
+
+			for i := range test.sent {
+				if i == test.sent-1 {
+					time.Sleep(test.wait)
+				}
+
+				// Stored even though nobody receives it
+				harness.Instance.SendOne("room:1", neogate.Event{Name: strconv.Itoa(i), Data: map[string]any{"count": i}})
+			}
+
+			history, err := harness.Instance.GetHistory("room:1")
+			if err != nil {
+				t.Fatalf("couldn't get history: %s", err)
+			}
+			if got := eventNames(history); !slices.Equal(got, test.history) {
+				t.Fatalf("history = %q, want %q", got, test.history)
+			}
+			for _, event := range history {
+				if count, _ := strconv.Atoi(event.Name); event.Data.(map[string]any)["count"] != float64(count) {
+					t.Fatalf("event %s has data %v", event.Name, event.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryHistoryStoreLimit(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{
+		History:      []neogate.HistoryConfig{{Pattern: "room:*"}},
+		HistoryStore: neogate.NewMemoryHistoryStoreWithLimit(2),
+	})
+	history := func(id string) []string {
+		t.Helper()
+		events, err := harness.Instance.GetHistory(id)
+		if err != nil {
+			t.Fatalf("couldn't get history of %s: %s", id, err)
+		}
+		return eventNames(events)
+	}
+
+	harness.Instance.SendOne("room:a", neogate.Event{Name: "a"})
+	harness.Instance.SendOne("room:b", neogate.Event{Name: "b"})
+
+	// Loading the history of a counts as using it, so b is the one dropped
+	history("room:a")
+	harness.Instance.SendOne("room:c", neogate.Event{Name: "c"})
+
+	for id, want := range map[string][]string{"room:a": {"a"}, "room:b": {}, "room:c": {"c"}} {
+		if got := history(id); !slices.Equal(got, want) {
+			t.Errorf("history of %s = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestReplayHistory(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{History: []neogate.HistoryConfig{{Pattern: "room", MaxEvents: 1000}}})
+
+	// Send events while the adapter is registered, it should get all of them exactly once and in order
+	sent := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := range 1000 {
+			if i == 100 {
+				close(started)
+			}
+			harness.Instance.SendOne("room", neogate.Event{Name: strconv.Itoa(i)})
+		}
+	}()
+	<-started
+
+	mutex := &sync.Mutex{}
+	received := []string{}
+	_, err := harness.Instance.Adapt(neogate.CreateAction{
+		ID:     "room",
+		Replay: true,
+		OnEvent: func(c *neogate.AdapterContext) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			received = append(received, c.Event.Name)
+			return nil
+		},
+		OnError: func(error) {},
+	})
+	if err != nil {
+		t.Fatalf("couldn't register adapter: %s", err)
+	}
+	<-sent
+
+	want := []string{}
+	for i := range 1000 {
+		want = append(want, strconv.Itoa(i))
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !slices.Equal(received, want) {
+		t.Fatalf("adapter received %d events (%q...), want 0 to 999 in order", len(received), received[:min(len(received), 10)])
+	}
+}
+
+func TestReplayHistoryToSession(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{History: []neogate.HistoryConfig{{Pattern: "room", MaxEvents: 2}}})
+	for _, name := range []string{"a", "b", "c"} {
+		harness.Instance.SendOne("room", neogate.Event{Name: name})
+	}
+
+	session := harness.Connect(t, "alice", neogate.None{})
+	if err := harness.Instance.ReplayHistoryToSession(session.Session, "room"); err != nil {
+		t.Fatalf("couldn't replay history: %s", err)
+	}
+	session.ExpectEvent(t, "b")
+	session.ExpectEvent(t, "c")
+	session.ExpectNoEvent(t, "a", 50*time.Millisecond)
+
+	// Adapters without a history don't send anything
+	received := len(session.Events(t))
+	if err := harness.Instance.ReplayHistoryToSession(session.Session, "lobby"); err != nil {
+		t.Fatalf("couldn't replay empty history: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := len(session.Events(t)); got != received {
+		t.Fatalf("replaying an empty history sent %d events", got-received)
+	}
+}
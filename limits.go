@@ -0,0 +1,70 @@
+package neogate
+
+import (
+	"net/http"
+)
+
+// What happens when a user exceeds Config.MaxSessionsPerUser.
+type SessionLimitPolicy int
+
+const (
+	SessionLimitReject      SessionLimitPolicy = iota // Reject the new connection in the handshake
+	SessionLimitEvictOldest                           // Accept the new connection and disconnect the oldest sessions
+	SessionLimitSingle                                // Only allow one session, a new connection disconnects all others (ignores MaxSessionsPerUser)
+)
+
+// Close reason evicted sessions receive.
+const SessionLimitCloseReason = "session limit reached"
+
+// Check if the user is allowed to create another session (only rejects in case the policy says so).
+//
+// This is only done early to not accept connections that will be rejected anyway,
+// the limit is enforced when the session is added (concurrent handshakes could pass this check).
+func (instance *Instance[T]) checkSessionLimit(userId string) *HandshakeError {
+	if instance.sessionLimitReached(userId) {
+		Log.Println("closed connection: session limit reached for", userId)
+		return &HandshakeError{
+			Status:  http.StatusTooManyRequests,
+			Message: SessionLimitCloseReason,
+		}
+	}
+	return nil
+}
+
+// Check if a new session of the user has to be rejected.
+func (instance *Instance[T]) sessionLimitReached(userId string) bool {
+	if instance.Config.SessionLimitPolicy != SessionLimitReject || instance.Config.MaxSessionsPerUser <= 0 {
+		return false
+	}
+	return instance.GetConnections(userId) >= instance.Config.MaxSessionsPerUser
+}
+
+// Disconnect the oldest sessions of the user in case the new session exceeds the limit (needs the user to be locked using lockUser).
+func (instance *Instance[T]) evictSessions(session *Session[T]) {
+	limit := instance.Config.MaxSessionsPerUser
+	switch instance.Config.SessionLimitPolicy {
+	case SessionLimitSingle:
+		limit = 1
+	case SessionLimitEvictOldest:
+		if limit <= 0 {
+			return
+		}
+	default:
+		return
+	}
+
+	// Sessions are stored in the order they connected in
+	sessions := instance.GetSessions(session.userId)
+	evict := len(sessions) - limit
+	for _, sessionId := range sessions {
+		if evict <= 0 {
+			break
+		}
+		if sessionId == session.sessionId {
+			continue
+		}
+
+		instance.DisconnectSessionWithReason(session.userId, sessionId, SessionLimitCloseReason)
+		evict--
+	}
+}
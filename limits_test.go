@@ -0,0 +1,82 @@
+package neogate_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Liphium/neogate"
+	"github.com/Liphium/neogate/neogatetest"
+)
+
+func TestSessionLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   neogate.SessionLimitPolicy
+		max      int
+		connects int
+		rejected int   // Amount of sessions that are rejected (the last ones)
+		evicted  []int // Sessions that are disconnected by the newer ones
+	}{
+		{name: "unlimited", max: 0, connects: 3},
+		{name: "reject", policy: neogate.SessionLimitReject, max: 2, connects: 4, rejected: 2},
+		{name: "evict oldest", policy: neogate.SessionLimitEvictOldest, max: 2, connects: 4, evicted: []int{0, 1}},
+		{name: "evict oldest without maximum", policy: neogate.SessionLimitEvictOldest, connects: 3},
+		{name: "single", policy: neogate.SessionLimitSingle, max: 5, connects: 3, evicted: []int{0, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{
+				MaxSessionsPerUser: test.max,
+				SessionLimitPolicy: test.policy,
+			})
+
+			// Sessions of other users don't count
+			bob := harness.Connect(t, "bob", neogate.None{})
+
+			sessions := []*neogatetest.Session[neogate.None]{}
+			for range test.connects - test.rejected {
+				sessions = append(sessions, harness.Connect(t, "alice", neogate.None{}))
+			}
+			for range test.rejected {
+
+				// The handshake already rejects the connection
+				_, handshakeErr := harness.Instance.Accept(&neogate.HandshakeRequest{Header: http.Header{"User": {"alice"}}})
+				if handshakeErr == nil || handshakeErr.Status != http.StatusTooManyRequests {
+					t.Fatalf("handshake returned %v, want status %d", handshakeErr, http.StatusTooManyRequests)
+				}
+
+				// Sessions that passed the handshake before the limit was reached are closed when they're opened
+				conn := neogatetest.NewConn()
+				if _, ok := harness.Instance.Open(conn, neogate.SessionInfo[neogate.None]{UserId: "alice"}); ok {
+					t.Fatal("session over the limit was opened")
+				}
+				if reason, _ := conn.CloseReason(); reason != neogate.SessionLimitCloseReason {
+					t.Fatalf("rejected session was closed with reason %q", reason)
+				}
+			}
+
+			remaining := []string{}
+			for i, session := range sessions {
+				if slices.Contains(test.evicted, i) {
+					session.ExpectCloseReason(t, neogate.SessionLimitCloseReason)
+					continue
+				}
+
+				// Evicting happens while the newer session is opened, so everything else has to be open
+				if session.Conn.IsClosed() {
+					t.Fatalf("session %d was closed", i)
+				}
+				remaining = append(remaining, session.GetSessionId())
+			}
+
+			if got := harness.Instance.GetSessions("alice"); !slices.Equal(got, remaining) {
+				t.Fatalf("sessions of alice = %v, want %v", got, remaining)
+			}
+			if bob.Conn.IsClosed() {
+				t.Fatal("session of another user was closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package neogate
+
+import (
+	"errors"
+	"sync"
+)
+
+// What happens when an event is sent to an adapter with a full mailbox.
+type MailboxOverflowPolicy int
+
+const (
+	MailboxBlock      MailboxOverflowPolicy = iota // Wait until there is space in the mailbox
+	MailboxDropNewest                              // Drop the new event (Send returns ErrMailboxFull)
+	MailboxDropOldest                              // Drop the oldest event in the mailbox to make room for the new one
+	MailboxError                                   // Drop the new event and call OnError of the adapter with ErrMailboxFull (not for the adapters of sessions and users)
+)
+
+var ErrMailboxFull = errors.New("mailbox of adapter is full")
+var ErrAdapterRemoved = errors.New("adapter was removed")
+
+// Config for delivering events to an adapter asynchronously. Events are queued in a mailbox and delivered
+// in order by a worker of the adapter, so Send doesn't have to wait for slow adapters.
+type MailboxConfig struct {
+	Size     int // Maximum amount of queued events (0 = no mailbox, events are delivered while sending)
+	Overflow MailboxOverflowPolicy
+}
+
+type mailboxItem struct {
+	event Event
+	msg   []byte
+}
+
+type mailbox struct {
+	policy MailboxOverflowPolicy
+	queue  chan mailboxItem
+	done   chan struct{} // Closed once the adapter was removed
+
+	mutex  *sync.RWMutex // Held while pushing, so no event is queued after the mailbox was closed
+	closed bool
+}
+
+// Create the mailbox for an adapter and start its worker (nil in case events should be delivered synchronously).
+func newMailbox(config *MailboxConfig, adapter *Adapter) *mailbox {
+	if config == nil || config.Size <= 0 {
+		return nil
+	}
+
+	mailbox := &mailbox{
+		policy: config.Overflow,
+		queue:  make(chan mailboxItem, config.Size),
+		done:   make(chan struct{}),
+		mutex:  &sync.RWMutex{},
+	}
+	go mailbox.run(adapter)
+	return mailbox
+}
+
+// Deliver the queued events until the adapter is removed.
+func (mailbox *mailbox) run(adapter *Adapter) {
+	for {
+		select {
+		case item := <-mailbox.queue:
+
+			// Don't deliver anything after the adapter was removed
+			select {
+			case <-mailbox.done:
+				adapter.stats.drop(1)
+				return
+			default:
+			}
+			adapter.deliver(item.event, item.msg)
+		case <-mailbox.done:
+			return
+		}
+	}
+}
+
+// Queue an event for the adapter. Returns ErrAdapterRemoved in case the mailbox was already closed.
+func (mailbox *mailbox) push(adapter *Adapter, item mailboxItem) error {
+	mailbox.mutex.RLock()
+	defer mailbox.mutex.RUnlock()
+
+	if mailbox.closed {
+		return ErrAdapterRemoved
+	}
+
+	switch mailbox.policy {
+	case MailboxDropNewest, MailboxError:
+		select {
+		case mailbox.queue <- item:
+			return nil
+		case <-mailbox.done:
+			return ErrAdapterRemoved
+		default:
+		}
+
+		adapter.stats.drop(1)
+
+		// Adapters of sessions and users would remove themselves, so they only get the error returned
+		if mailbox.policy == MailboxError && !adapter.internal {
+			adapter.OnError(ErrMailboxFull)
+		}
+		return ErrMailboxFull
+	case MailboxDropOldest:
+		for {
+			select {
+			case mailbox.queue <- item:
+				return nil
+			case <-mailbox.done:
+				return ErrAdapterRemoved
+			default:
+			}
+
+			// Make room by dropping the oldest event (unless the worker just took it)
+			select {
+			case <-mailbox.queue:
+				adapter.stats.drop(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case mailbox.queue <- item:
+			return nil
+		case <-mailbox.done:
+			return ErrAdapterRemoved
+		}
+	}
+}
+
+// Stop the worker (queued events are dropped).
+func (mailbox *mailbox) close(adapter *Adapter) {
+
+	// Wake up blocked pushes first, they hold the lock
+	close(mailbox.done)
+
+	mailbox.mutex.Lock()
+	defer mailbox.mutex.Unlock()
+
+	mailbox.closed = true
+	dropped := 0
+	for len(mailbox.queue) > 0 {
+		<-mailbox.queue
+		dropped++
+	}
+	adapter.stats.drop(dropped)
+}
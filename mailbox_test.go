@@ -0,0 +1,274 @@
+package neogate_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+)
+
+// Adapter that blocks on the event named "slow" until release is called.
+type gatedAdapter struct {
+	subscription *neogate.Subscription
+	started      chan struct{} // Gets a value once the slow event is being handled
+	gate         chan struct{}
+	release      func()
+
+	mutex     *sync.Mutex
+	delivered []string
+	errors    []error
+}
+
+func newGatedAdapter(t *testing.T, instance *neogate.Instance[neogate.None], id string, mailbox neogate.MailboxConfig) *gatedAdapter {
+	t.Helper()
+
+	adapter := &gatedAdapter{
+		started: make(chan struct{}, 1),
+		gate:    make(chan struct{}),
+		mutex:   &sync.Mutex{},
+	}
+	once := &sync.Once{}
+	adapter.release = func() {
+		once.Do(func() { close(adapter.gate) })
+	}
+	t.Cleanup(adapter.release)
+
+	subscription, err := instance.Adapt(neogate.CreateAction{
+		ID:      id,
+		Mailbox: &mailbox,
+		OnEvent: func(c *neogate.AdapterContext) error {
+			if c.Event.Name == "slow" {
+				adapter.started <- struct{}{}
+				<-adapter.gate
+			}
+
+			adapter.mutex.Lock()
+			defer adapter.mutex.Unlock()
+			adapter.delivered = append(adapter.delivered, c.Event.Name)
+			return nil
+		},
+		OnError: func(err error) {
+			adapter.mutex.Lock()
+			defer adapter.mutex.Unlock()
+			adapter.errors = append(adapter.errors, err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("couldn't register adapter: %s", err)
+	}
+	adapter.subscription = subscription
+	return adapter
+}
+
+// Send the slow event and wait until the worker is stuck handling it.
+func (adapter *gatedAdapter) block(t *testing.T, instance *neogate.Instance[neogate.None]) {
+	t.Helper()
+
+	if err := instance.SendOne(adapter.subscription.Adapter.ID, neogate.Event{Name: "slow"}); err != nil {
+		t.Fatalf("couldn't send slow event: %s", err)
+	}
+	select {
+	case <-adapter.started:
+	case <-time.After(time.Second):
+		t.Fatal("adapter didn't receive the slow event")
+	}
+}
+
+// Wait until the adapter handled the amount of events and return their names.
+func (adapter *gatedAdapter) waitDelivered(t *testing.T, count int) []string {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	for {
+		adapter.mutex.Lock()
+		delivered := slices.Clone(adapter.delivered)
+		adapter.mutex.Unlock()
+		if len(delivered) >= count {
+			return delivered
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("adapter only received %q, want %d events", delivered, count)
+			return nil
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// Get the error for the adapter returned by Send.
+func adapterError(err error, id string) error {
+	var sendErr *neogate.AdapterSendError
+	if errors.As(err, &sendErr) {
+		return sendErr.AdapterErrors[id]
+	}
+	return err
+}
+
+func TestMailboxOrder(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{})
+	adapter := newGatedAdapter(t, harness.Instance, "room", neogate.MailboxConfig{Size: 10})
+
+	want := []string{}
+	for i := range 100 {
+		name := strconv.Itoa(i)
+		want = append(want, name)
+		if err := harness.Instance.SendOne("room", neogate.Event{Name: name}); err != nil {
+			t.Fatalf("couldn't send event %d: %s", i, err)
+		}
+	}
+
+	if got := adapter.waitDelivered(t, len(want)); !slices.Equal(got, want) {
+		t.Fatalf("delivered %q, want %q", got, want)
+	}
+	if stats := adapter.subscription.Adapter.Stats(); stats.Delivered != 100 || stats.Dropped != 0 || stats.Queued != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestMailboxOverflow(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    neogate.MailboxOverflowPolicy
+		err       error    // Returned when sending the event that doesn't fit
+		delivered []string // Events handled by the adapter in the end
+		dropped   int64
+		onError   bool // If OnError is called with ErrMailboxFull
+	}{
+		{name: "block", policy: neogate.MailboxBlock, delivered: []string{"slow", "a", "b", "c"}},
+		{name: "drop newest", policy: neogate.MailboxDropNewest, err: neogate.ErrMailboxFull, delivered: []string{"slow", "a", "b"}, dropped: 1},
+		{name: "drop oldest", policy: neogate.MailboxDropOldest, delivered: []string{"slow", "b", "c"}, dropped: 1},
+		{name: "error", policy: neogate.MailboxError, err: neogate.ErrMailboxFull, delivered: []string{"slow", "a", "b"}, dropped: 1, onError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{})
+			adapter := newGatedAdapter(t, harness.Instance, "room", neogate.MailboxConfig{Size: 2, Overflow: test.policy})
+
+			// Fill the mailbox while the worker is stuck
+			adapter.block(t, harness.Instance)
+			for _, name := range []string{"a", "b"} {
+				if err := harness.Instance.SendOne("room", neogate.Event{Name: name}); err != nil {
+					t.Fatalf("couldn't send %s: %s", name, err)
+				}
+			}
+			if queued := adapter.subscription.Adapter.Stats().Queued; queued != 2 {
+				t.Fatalf("%d events are queued, want 2", queued)
+			}
+
+			sent := make(chan error, 1)
+			go func() {
+				sent <- harness.Instance.SendOne("room", neogate.Event{Name: "c"})
+			}()
+			if test.policy == neogate.MailboxBlock {
+				select {
+				case err := <-sent:
+					t.Fatalf("send didn't wait for space in the mailbox (%v)", err)
+				case <-time.After(20 * time.Millisecond):
+				}
+				adapter.release()
+			}
+			if err := adapterError(<-sent, "room"); !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("send returned %v, want %v", err, test.err)
+			}
+			adapter.release()
+
+			if got := adapter.waitDelivered(t, len(test.delivered)); !slices.Equal(got, test.delivered) {
+				t.Fatalf("delivered %q, want %q", got, test.delivered)
+			}
+			if dropped := adapter.subscription.Adapter.Stats().Dropped; dropped != test.dropped {
+				t.Fatalf("%d events were dropped, want %d", dropped, test.dropped)
+			}
+			adapter.mutex.Lock()
+			defer adapter.mutex.Unlock()
+			if onError := slices.ContainsFunc(adapter.errors, func(err error) bool { return errors.Is(err, neogate.ErrMailboxFull) }); onError != test.onError {
+				t.Fatalf("OnError called with %v, want it to be called: %t", adapter.errors, test.onError)
+			}
+		})
+	}
+}
+
+func TestMailboxBlockUnblocksOnRemoval(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{})
+	adapter := newGatedAdapter(t, harness.Instance, "room", neogate.MailboxConfig{Size: 1})
+
+	adapter.block(t, harness.Instance)
+	if err := harness.Instance.SendOne("room", neogate.Event{Name: "queued"}); err != nil {
+		t.Fatalf("couldn't send: %s", err)
+	}
+	sent := make(chan error, 1)
+	go func() {
+		sent <- harness.Instance.SendOne("room", neogate.Event{Name: "waiting"})
+	}()
+
+	harness.Instance.RemoveAdapter("room")
+	select {
+	case err := <-sent:
+		if err := adapterError(err, "room"); !errors.Is(err, neogate.ErrAdapterRemoved) && !errors.Is(err, neogate.ErrAdapterNotFound) {
+			t.Fatalf("blocked send returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("send is still blocked after the adapter was removed")
+	}
+
+	// The queued event is dropped instead of being delivered to the removed adapter
+	adapter.release()
+	time.Sleep(20 * time.Millisecond)
+	if got := adapter.waitDelivered(t, 1); !slices.Equal(got, []string{"slow"}) {
+		t.Fatalf("delivered %q after removal", got)
+	}
+	if dropped := adapter.subscription.Adapter.Stats().Dropped; dropped != 1 {
+		t.Fatalf("%d events were dropped, want 1", dropped)
+	}
+}
+
+func TestMailboxErrorInternalAdapters(t *testing.T) {
+
+	// Writing events named slow to a session blocks until the gate is closed
+	started := make(chan struct{}, 1)
+	gate := make(chan struct{})
+	harness := newHarness(t, neogate.Config[neogate.None]{
+		AdapterMailbox: &neogate.MailboxConfig{Size: 1, Overflow: neogate.MailboxError},
+		EncodingMiddleware: func(_ *neogate.Session[neogate.None], _ *neogate.Instance[neogate.None], message []byte) ([]byte, error) {
+			if bytes.Contains(message, []byte(`"slow"`)) {
+				started <- struct{}{}
+				<-gate
+			}
+			return message, nil
+		},
+	})
+	session := harness.Connect(t, "alice", neogate.None{})
+	adapterId := "session:alice:" + session.GetSessionId()
+
+	if err := harness.Instance.SendOne(adapterId, neogate.Event{Name: "slow"}); err != nil {
+		t.Fatalf("couldn't send: %s", err)
+	}
+	<-started
+	if err := harness.Instance.SendOne(adapterId, neogate.Event{Name: "queued"}); err != nil {
+		t.Fatalf("couldn't send: %s", err)
+	}
+	if err := adapterError(harness.Instance.SendOne(adapterId, neogate.Event{Name: "overflow"}), adapterId); !errors.Is(err, neogate.ErrMailboxFull) {
+		t.Fatalf("send to full mailbox returned %v", err)
+	}
+	close(gate)
+
+	// The adapter of the session doesn't remove itself because of the error
+	session.ExpectEvent(t, "queued")
+	info, ok := harness.Instance.GetAdapter(adapterId)
+	if !ok {
+		t.Fatal("adapter of the session was removed")
+	}
+	if dropped := info.Adapters[0].Dropped; dropped != 1 {
+		t.Fatalf("%d events were dropped, want 1", dropped)
+	}
+	if err := harness.Instance.SendOne(adapterId, neogate.Event{Name: "after"}); err != nil {
+		t.Fatalf("couldn't send after the overflow: %s", err)
+	}
+	session.ExpectEvent(t, "after")
+}
@@ -0,0 +1,125 @@
+package neogate
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Config for the request metadata captured for every session.
+type MetadataConfig struct {
+	Headers []string // Headers of the handshake request to capture (e.g. User-Agent)
+	Query   []string // Query parameters of the handshake request to capture
+
+	// Proxies (ips or cidrs) that are trusted to set X-Forwarded-For. The remote address of requests coming
+	// from them is the last address in X-Forwarded-For that isn't a trusted proxy.
+	TrustedProxies []string
+}
+
+// Information about the connection of a session captured from the handshake request.
+type SessionMetadata struct {
+	RemoteAddr  string            // Ip of the client (honoring trusted proxies)
+	UserAgent   string            // Always captured (also in case MetadataConfig.Headers doesn't contain it)
+	Headers     map[string]string // Captured headers (key as configured)
+	Query       map[string]string // Captured query parameters
+	ConnectedAt time.Time
+}
+
+// Get the metadata of the connection of the session.
+func (session *Session[T]) GetMetadata() *SessionMetadata {
+	return session.metadata
+}
+
+// Parse the trusted proxies from the config (invalid entries are reported and ignored).
+func (instance *Instance[T]) parseTrustedProxies() []netip.Prefix {
+	if instance.Config.Metadata == nil {
+		return nil
+	}
+
+	prefixes := []netip.Prefix{}
+	for _, proxy := range instance.Config.Metadata.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				instance.ReportGeneralError("invalid trusted proxy "+proxy, err)
+				continue
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			instance.ReportGeneralError("invalid trusted proxy "+proxy, err)
+			continue
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes
+}
+
+func (instance *Instance[T]) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range instance.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ip of the client that sent the request (without the port), honoring X-Forwarded-For of trusted proxies.
+func (instance *Instance[T]) clientIP(req *HandshakeRequest) string {
+	ip := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !instance.isTrustedProxy(ip) {
+		return ip
+	}
+
+	// Go through the forwarded addresses from the closest proxy to the client
+	forwarded := []string{}
+	for _, value := range req.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(value, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip = strings.TrimSpace(forwarded[i])
+		if !instance.isTrustedProxy(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// Capture the metadata for a session from the handshake request.
+func (instance *Instance[T]) captureMetadata(req *HandshakeRequest) *SessionMetadata {
+	metadata := &SessionMetadata{
+		RemoteAddr: instance.clientIP(req),
+		UserAgent:  req.Header.Get("User-Agent"),
+		Headers:    map[string]string{},
+		Query:      map[string]string{},
+	}
+
+	config := instance.Config.Metadata
+	if config == nil {
+		return metadata
+	}
+	for _, header := range config.Headers {
+		if value := req.Header.Get(header); value != "" {
+			metadata.Headers[header] = value
+		}
+	}
+	for _, param := range config.Query {
+		if value := req.Query.Get(param); value != "" {
+			metadata.Query[param] = value
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,99 @@
+package neogate_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Liphium/neogate"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		forwarded  []string // X-Forwarded-For headers
+		want       string
+	}{
+		{
+			name:       "no proxies",
+			remoteAddr: "203.0.113.7:4000",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer",
+			trusted:    []string{"10.0.0.1"},
+			remoteAddr: "203.0.113.7:4000",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy",
+			trusted:    []string{"10.0.0.1"},
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "spoofed addresses are skipped",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"192.0.2.66, 198.51.100.1, 10.1.2.3"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "multiple headers",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"192.0.2.66", "198.51.100.1 ,10.1.2.3"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "only proxies",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"10.1.2.3, 10.4.5.6"},
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "trusted proxy without header",
+			trusted:    []string{"10.0.0.1"},
+			remoteAddr: "10.0.0.1:4000",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "ipv6",
+			trusted:    []string{"::1"},
+			remoteAddr: "[::1]:4000",
+			forwarded:  []string{"2001:db8::1"},
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "address without port",
+			remoteAddr: "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{
+				Metadata: &neogate.MetadataConfig{TrustedProxies: test.trusted},
+			})
+
+			info, handshakeErr := harness.Instance.Accept(&neogate.HandshakeRequest{
+				RemoteAddr: test.remoteAddr,
+				Header:     http.Header{"User": []string{"alice"}, "X-Forwarded-For": test.forwarded},
+			})
+			if handshakeErr != nil {
+				t.Fatalf("handshake failed: %s", handshakeErr)
+			}
+
+			session := harness.ConnectInfo(t, info)
+			if got := session.GetMetadata().RemoteAddr; got != test.want {
+				t.Fatalf("remote address = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
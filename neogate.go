@@ -3,9 +3,10 @@ package neogate
 import (
 	"fmt"
 	"log"
+	"net/netip"
 	"sync"
-
-	"github.com/gofiber/fiber/v2"
+	"sync/atomic"
+	"time"
 )
 
 type None struct{}
@@ -17,8 +18,21 @@ type Instance[T any] struct {
 	Config           Config[T]
 	connectionsCache *sync.Map // UserId:sessionId -> *Session
 	sessionsCache    SessionCache
-	adapters         *sync.Map // AdapterId -> *Adapter
+	adapters         *sync.Map // AdapterId -> *adapterEntry
+	adapterIndex     *adapterIndex
+	fallbackConns    *sync.Map // Token -> *fallbackConn
 	routes           map[string]func(*Context[T]) Event
+	sessionCount     *atomic.Int64
+	admission        *admission
+	trustedProxies   []netip.Prefix
+	tagIndex         *tagIndex[T]
+	historyStore     HistoryStore
+	historyMutex     *sync.RWMutex // Held while recording an event and looking up its adapter (locked exclusively while registering adapters that replay their history)
+	userLocks        *userLocks
+	eventIdPrefix    string         // Random prefix of the event ids created by this instance
+	eventCounter     *atomic.Uint64 // Counter for the rest of the event ids
+	closed           chan struct{}  // Closed by Close to stop the background goroutines
+	closeOnce        *sync.Once
 }
 
 type SessionCache struct {
@@ -43,7 +57,51 @@ type Config[T any] struct {
 
 	// Called when a client attempts to connect(create a session). Return the session info and true if the connection is allowed.
 	// MUST BE SPECIFIED.
-	Handshake func(c *fiber.Ctx) (SessionInfo[T], bool)
+	Handshake func(req *HandshakeRequest) (SessionInfo[T], bool)
+
+	// Alternative to Handshake for clients that can't send headers with the upgrade request (like browsers): the connection is
+	// accepted without authentication and the first message of the client (as sent, not decoded) has to authenticate it.
+	// Return the session info and true if the connection is allowed. Handshake isn't called in case this is specified.
+	Authenticate func(req *HandshakeRequest, message []byte) (SessionInfo[T], bool)
+	AuthTimeout  time.Duration // How long the client has to send the first message (default: 10s)
+
+	// Called with requests sent by browsers on other sites (the Origin header), return true if they're allowed to connect.
+	// Only the site of the gateway itself is allowed in case it's nil, since browsers send cookies with these requests too.
+	CheckOrigin func(req *HandshakeRequest) bool
+
+	// Called when a client sends the reauth action before its session expires (see SessionInfo.ExpiresAt).
+	// Return the new session data, the new expiry and true if the session may continue.
+	Reauthenticate func(session *Session[T], data []byte) (T, time.Time, bool)
+	ExpiryWarning  time.Duration // How long before the expiry the client gets the session_expiring event (default: 1 minute)
+
+	// Actions that let users list and revoke their own sessions (not registered in case it's nil)
+	SessionActions *SessionActionsConfig[T]
+
+	// Tags of a session used to index it for QuerySessions and BroadcastWhere (e.g. "platform:desktop" or "tenant:x").
+	// Called once the session is opened and when RetagSession is called (e.g. after changing the data of a session).
+	SessionTags func(session *Session[T]) []string
+
+	// Deliver events to adapters asynchronously using mailboxes (nil = events are delivered while sending).
+	// Can be changed for every adapter using CreateAction.Mailbox.
+	AdapterMailbox *MailboxConfig
+
+	// Keep the last events sent to adapters (CreateAction.Replay passes them to new adapters).
+	// The events are stored in memory in case no store is specified (see NewMemoryHistoryStore for the limits).
+	History      []HistoryConfig
+	HistoryStore HistoryStore
+
+	// Store events sent to users that aren't connected (SendEventToUser) and deliver them once the first session
+	// of the user entered the network. Events are dropped after OutboxTTL (0 = never).
+	Outbox    OutboxStore
+	OutboxTTL time.Duration
+
+	// What happens when an adapter is registered for an id that already has one (replaces it by default)
+	AdapterConflictPolicy AdapterConflictPolicy
+
+	// How often adapters that expired or whose owner disconnected are removed (0 = only when SweepAdapters is called, stopped by Close).
+	// The handler is called with the amount of removed adapters in case there were any.
+	AdapterSweepInterval time.Duration
+	AdapterSweepHandler  func(result AdapterSweepResult)
 
 	// Session handlers
 	SessionDisconnectHandler   func(session *Session[T])
@@ -53,9 +111,33 @@ type Config[T any] struct {
 	// Returns id of user adapter based on session.GetUserId(), and if of session adapter based on session.GetSessionId()
 	SessionAdapterHandler func(userId string, sessionId string) (string, string)
 
+	// Maximum amount of sessions per user (0 = unlimited) and what happens when a user exceeds it (rejects new connections by default).
+	MaxSessionsPerUser int
+	SessionLimitPolicy SessionLimitPolicy
+
+	// Limits for accepting new connections (nothing is limited in case it's nil)
+	Admission *AdmissionConfig
+
+	// What's captured from the handshake request for Session.GetMetadata (only the remote address in case it's nil)
+	Metadata *MetadataConfig
+
+	// Serve clients that can't use websockets with the fallback transport: events are streamed using server-sent events
+	// (GET with Accept: text/event-stream) and actions are posted to the same endpoint with the token of the session in the
+	// X-Neogate-Token header. The first event on the stream is named "session" and contains the token.
+	EnableFallback bool
+
+	// Add an id, timestamp and origin (NodeID) to every event that's sent (see Event). Clients that don't
+	// know about these fields receive the compact shape ({"name", "data"}) in case this is disabled.
+	EventMetadata bool
+	NodeID        string
+
 	// Codec middleware
 	EncodingMiddleware func(session *Session[T], instance *Instance[T], message []byte) ([]byte, error)
 	DecodingMiddleware func(session *Session[T], instance *Instance[T], message []byte) ([]byte, error)
+	SharedEncoding     bool // Enable in case the encoding middleware doesn't depend on the session, broadcasts only encode the event once then
+
+	// How many sessions broadcasts (BroadcastAll, BroadcastWhere) send to at the same time (default: 16)
+	BroadcastWorkers int
 
 	// Error handler
 	ErrorHandler func(err error)
@@ -82,16 +164,46 @@ func Setup[T any](config Config[T]) *Instance[T] {
 	instance := &Instance[T]{
 		Config:           config,
 		adapters:         &sync.Map{},
+		adapterIndex:     newAdapterIndex(),
+		fallbackConns:    &sync.Map{},
 		connectionsCache: &sync.Map{},
 		sessionsCache: SessionCache{
 			sessions: &sync.Map{},
 			mutex:    &sync.Mutex{},
 		},
-		routes: make(map[string]func(*Context[T]) Event),
+		routes:        make(map[string]func(*Context[T]) Event),
+		sessionCount:  &atomic.Int64{},
+		tagIndex:      newTagIndex[T](),
+		historyStore:  config.HistoryStore,
+		historyMutex:  &sync.RWMutex{},
+		userLocks:     newUserLocks(),
+		eventIdPrefix: GenerateToken(12),
+		eventCounter:  &atomic.Uint64{},
+		closed:        make(chan struct{}),
+		closeOnce:     &sync.Once{},
+	}
+	if instance.historyStore == nil {
+		instance.historyStore = NewMemoryHistoryStore()
+	}
+	instance.trustedProxies = instance.parseTrustedProxies()
+	if config.Admission != nil {
+		instance.admission = newAdmission(*config.Admission)
+	}
+	instance.registerReauth()
+	instance.registerSessionActions()
+	if config.AdapterSweepInterval > 0 {
+		go instance.runAdapterSweeper()
 	}
 	return instance
 }
 
+// Stop the goroutines of the instance (like the adapter sweeper and ServeListener). Sessions and adapters aren't removed.
+func (instance *Instance[T]) Close() {
+	instance.closeOnce.Do(func() {
+		close(instance.closed)
+	})
+}
+
 func (instance *Instance[T]) ReportGeneralError(context string, err error) {
 	if instance.Config.ErrorHandler == nil {
 		return
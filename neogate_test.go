@@ -0,0 +1,42 @@
+package neogate_test
+
+import (
+	"testing"
+
+	"github.com/Liphium/neogate"
+	"github.com/Liphium/neogate/neogatetest"
+)
+
+// Create a harness for an instance with the config (handlers that aren't specified get defaults).
+// The handshake uses the User header as the id of the user.
+func newHarness(t *testing.T, config neogate.Config[neogate.None]) *neogatetest.Harness[neogate.None] {
+	t.Helper()
+
+	if config.Handshake == nil {
+		config.Handshake = func(req *neogate.HandshakeRequest) (neogate.SessionInfo[neogate.None], bool) {
+			return neogate.SessionInfo[neogate.None]{UserId: req.Get("User")}, true
+		}
+	}
+	if config.SessionEnterNetworkHandler == nil {
+		config.SessionEnterNetworkHandler = func(*neogate.Session[neogate.None], neogate.None) bool {
+			return false
+		}
+	}
+	if config.SessionDisconnectHandler == nil {
+		config.SessionDisconnectHandler = func(*neogate.Session[neogate.None]) {}
+	}
+	if config.SessionAdapterHandler == nil {
+		config.SessionAdapterHandler = func(userId string, sessionId string) (string, string) {
+			return "user:" + userId, "session:" + userId + ":" + sessionId
+		}
+	}
+	if config.EncodingMiddleware == nil {
+		config.EncodingMiddleware = neogate.DefaultEncodingMiddleware[neogate.None]
+	}
+	if config.DecodingMiddleware == nil {
+		config.DecodingMiddleware = neogate.DefaultDecodingMiddleware[neogate.None]
+	}
+	instance := neogate.Setup(config)
+	t.Cleanup(instance.Close)
+	return neogatetest.New(instance)
+}
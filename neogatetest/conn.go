@@ -0,0 +1,157 @@
+package neogatetest
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+var ErrClosed = errors.New("connection closed")
+
+// Conn is an in-memory neogate.Conn. Messages written by neogate are captured, messages to neogate are injected using Inject.
+type Conn struct {
+	inbound   chan []byte
+	closed    chan struct{}
+	closeOnce *sync.Once
+
+	mutex           *sync.Mutex
+	outbound        [][]byte
+	changed         chan struct{} // Closed and replaced every time a message is written
+	closeReason     *string       // Reason of the close message written by neogate (nil = none was written)
+	deadline        time.Time
+	deadlineChanged chan struct{} // Closed and replaced every time the read deadline changes
+}
+
+func NewConn() *Conn {
+	return &Conn{
+		inbound:   make(chan []byte),
+		closed:    make(chan struct{}),
+		closeOnce: &sync.Once{},
+		mutex:     &sync.Mutex{},
+		outbound:  [][]byte{},
+		changed:   make(chan struct{}),
+
+		deadlineChanged: make(chan struct{}),
+	}
+}
+
+// Inject a message as if the client sent it. Blocks until neogate reads it.
+func (conn *Conn) Inject(msg []byte) error {
+	select {
+	case conn.inbound <- msg:
+		return nil
+	case <-conn.closed:
+		return ErrClosed
+	}
+}
+
+// Messages written to the connection so far.
+func (conn *Conn) Written() [][]byte {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	return append([][]byte{}, conn.outbound...)
+}
+
+// Returns a channel that is closed once something is written or the connection is closed.
+func (conn *Conn) waitChannel() chan struct{} {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	return conn.changed
+}
+
+// Reason of the close message neogate wrote before closing the connection (e.g. neogate.SessionLimitCloseReason).
+// Returns false in case it didn't write one.
+func (conn *Conn) CloseReason() (string, bool) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.closeReason == nil {
+		return "", false
+	}
+	return *conn.closeReason, true
+}
+
+func (conn *Conn) IsClosed() bool {
+	select {
+	case <-conn.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (conn *Conn) ReadMessage() (int, []byte, error) {
+	for {
+		conn.mutex.Lock()
+		deadline := conn.deadline
+		deadlineChanged := conn.deadlineChanged
+		conn.mutex.Unlock()
+
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timeout = time.After(time.Until(deadline))
+		}
+
+		select {
+		case msg := <-conn.inbound:
+			return websocket.BinaryMessage, msg, nil
+		case <-conn.closed:
+			return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-deadlineChanged:
+		}
+	}
+}
+
+func (conn *Conn) WriteMessage(messageType int, data []byte) error {
+	if conn.IsClosed() {
+		return ErrClosed
+	}
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	// Control messages aren't events, only the reason of close messages is kept
+	switch messageType {
+	case websocket.TextMessage, websocket.BinaryMessage:
+		conn.outbound = append(conn.outbound, data)
+		close(conn.changed)
+		conn.changed = make(chan struct{})
+	case websocket.CloseMessage:
+		reason := ""
+		if len(data) > 2 {
+			reason = string(data[2:]) // The first 2 bytes are the close code
+		}
+		conn.closeReason = &reason
+	}
+	return nil
+}
+
+// Reads return os.ErrDeadlineExceeded after the deadline (like a network connection).
+func (conn *Conn) SetReadDeadline(t time.Time) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	conn.deadline = t
+	close(conn.deadlineChanged)
+	conn.deadlineChanged = make(chan struct{})
+	return nil
+}
+
+func (conn *Conn) Close() error {
+	conn.closeOnce.Do(func() {
+		close(conn.closed)
+
+		conn.mutex.Lock()
+		close(conn.changed)
+		conn.changed = make(chan struct{})
+		conn.mutex.Unlock()
+	})
+	return nil
+}
@@ -0,0 +1,294 @@
+// Package neogatetest runs neogate sessions in memory so handlers and adapters can be tested without fiber or a websocket client.
+package neogatetest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+	"github.com/bytedance/sonic"
+)
+
+type Harness[T any] struct {
+	Instance *neogate.Instance[T]
+	Timeout  time.Duration // How long expectations wait before failing (default: 1 second)
+
+	// Codec of the client (the counterpart of the encoding/decoding middleware of the instance).
+	// Messages are left as they are when these aren't set.
+	Encode func(message []byte) ([]byte, error)
+	Decode func(message []byte) ([]byte, error)
+
+	mutex    *sync.Mutex
+	sessions map[string][]*Session[T] // UserId -> sessions
+}
+
+// Create a harness for an instance. The config of the instance is used as it is, so all handlers must be specified.
+func New[T any](instance *neogate.Instance[T]) *Harness[T] {
+	return &Harness[T]{
+		Instance: instance,
+		Timeout:  time.Second,
+		mutex:    &sync.Mutex{},
+		sessions: map[string][]*Session[T]{},
+	}
+}
+
+// A fake session connected through the harness.
+type Session[T any] struct {
+	*neogate.Session[T]
+	Conn *Conn
+
+	harness *Harness[T]
+	done    chan struct{} // Closed once neogate stopped serving the session
+}
+
+// Connect a new session for the user. Everything after the handshake runs exactly like it does for a websocket connection.
+//
+// The session is closed automatically when the test finishes.
+func (harness *Harness[T]) Connect(t testing.TB, userId string, data T) *Session[T] {
+	t.Helper()
+	return harness.ConnectInfo(t, neogate.SessionInfo[T]{
+		UserId: userId,
+		Data:   data,
+	})
+}
+
+// Connect a new session using session info like the one returned by the handshake (e.g. to test sessions that expire).
+func (harness *Harness[T]) ConnectInfo(t testing.TB, info neogate.SessionInfo[T]) *Session[T] {
+	t.Helper()
+
+	userId := info.UserId
+	conn := NewConn()
+	session, ok := harness.Instance.Open(conn, info)
+	if !ok {
+		t.Fatalf("session of user %s was rejected (by the enter network handler or the session limit)", userId)
+		return nil
+	}
+
+	fake := &Session[T]{
+		Session: session,
+		Conn:    conn,
+		harness: harness,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		harness.Instance.Serve(session)
+		close(fake.done)
+	}()
+
+	harness.mutex.Lock()
+	harness.sessions[userId] = append(harness.sessions[userId], fake)
+	harness.mutex.Unlock()
+
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// All sessions of the user connected through the harness (including closed ones).
+func (harness *Harness[T]) Sessions(userId string) []*Session[T] {
+	harness.mutex.Lock()
+	defer harness.mutex.Unlock()
+
+	return append([]*Session[T]{}, harness.sessions[userId]...)
+}
+
+// Wait until every open session of the user received an event with the name. Returns the event received by the first session.
+func (harness *Harness[T]) ExpectEventForUser(t testing.TB, userId string, name string) neogate.Event {
+	t.Helper()
+
+	var event *neogate.Event
+	for _, session := range harness.Sessions(userId) {
+		if session.Conn.IsClosed() {
+			continue
+		}
+
+		received := session.ExpectEvent(t, name)
+		if event == nil {
+			event = &received
+		}
+	}
+	if event == nil {
+		t.Fatalf("user %s doesn't have any open sessions", userId)
+		return neogate.Event{}
+	}
+	return *event
+}
+
+// Send an action with the data like a client would. Returns the generated response id.
+func (session *Session[T]) Send(t testing.TB, action string, data any) string {
+	t.Helper()
+
+	responseId := neogate.GenerateToken(8)
+	msg, err := sonic.Marshal(neogate.Message[any]{
+		Action: action + ":" + responseId,
+		Data:   data,
+	})
+	if err != nil {
+		t.Fatalf("couldn't marshal action %s: %s", action, err)
+		return ""
+	}
+
+	session.SendRaw(t, msg)
+	return responseId
+}
+
+// Send a message to neogate like a client would (it's encoded using Encode of the harness first).
+func (session *Session[T]) SendRaw(t testing.TB, msg []byte) {
+	t.Helper()
+
+	if session.harness.Encode != nil {
+		encoded, err := session.harness.Encode(msg)
+		if err != nil {
+			t.Fatalf("couldn't encode message: %s", err)
+			return
+		}
+		msg = encoded
+	}
+
+	if err := session.Conn.Inject(msg); err != nil {
+		t.Fatalf("couldn't send message to session %s: %s", session.GetSessionId(), err)
+	}
+}
+
+// All events received by the session so far.
+func (session *Session[T]) Events(t testing.TB) []neogate.Event {
+	t.Helper()
+
+	events := []neogate.Event{}
+	for _, msg := range session.Conn.Written() {
+		if session.harness.Decode != nil {
+			decoded, err := session.harness.Decode(msg)
+			if err != nil {
+				t.Fatalf("couldn't decode message: %s", err)
+				return nil
+			}
+			msg = decoded
+		}
+
+		var event neogate.Event
+		if err := sonic.Unmarshal(msg, &event); err != nil {
+			t.Fatalf("couldn't parse message %q: %s", string(msg), err)
+			return nil
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// Wait until the session received an event with the name.
+func (session *Session[T]) ExpectEvent(t testing.TB, name string) neogate.Event {
+	t.Helper()
+	return session.expect(t, "event "+name, func(event neogate.Event) bool {
+		return event.Name == name
+	})
+}
+
+// Wait until the session received the response for the response id returned by Send.
+func (session *Session[T]) ExpectResponse(t testing.TB, responseId string) neogate.Event {
+	t.Helper()
+	return session.expect(t, "response "+responseId, func(event neogate.Event) bool {
+		return strings.HasPrefix(event.Name, "res:") && strings.HasSuffix(event.Name, ":"+responseId)
+	})
+}
+
+// Make sure the session doesn't receive an event with the name for the duration.
+func (session *Session[T]) ExpectNoEvent(t testing.TB, name string, duration time.Duration) {
+	t.Helper()
+
+	timeout := time.After(duration)
+	for {
+		wait := session.Conn.waitChannel()
+		for _, event := range session.Events(t) {
+			if event.Name == name {
+				t.Fatalf("session %s of user %s received unexpected event %s", session.GetSessionId(), session.GetUserId(), name)
+				return
+			}
+		}
+		if session.Conn.IsClosed() {
+			return
+		}
+
+		select {
+		case <-wait:
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// Wait until neogate closed the session (or the session was closed using Close).
+func (session *Session[T]) ExpectDisconnected(t testing.TB) {
+	t.Helper()
+
+	select {
+	case <-session.done:
+	case <-time.After(session.harness.timeout()):
+		t.Fatalf("session %s of user %s wasn't disconnected", session.GetSessionId(), session.GetUserId())
+	}
+}
+
+// Wait until neogate closed the session and make sure it told the client the reason (e.g. neogate.SessionExpiredCloseReason).
+func (session *Session[T]) ExpectCloseReason(t testing.TB, reason string) {
+	t.Helper()
+
+	session.ExpectDisconnected(t)
+	if got, ok := session.Conn.CloseReason(); !ok || got != reason {
+		t.Fatalf("session %s of user %s was closed with reason %q (sent: %t), want %q", session.GetSessionId(), session.GetUserId(), got, ok, reason)
+	}
+}
+
+// Close the session like a client would and wait until neogate removed it.
+func (session *Session[T]) Close() {
+	session.Conn.Close()
+	<-session.done
+}
+
+func (session *Session[T]) expect(t testing.TB, description string, match func(neogate.Event) bool) neogate.Event {
+	t.Helper()
+
+	timeout := time.After(session.harness.timeout())
+	for {
+
+		// Get the channel before checking to not miss anything written in between
+		wait := session.Conn.waitChannel()
+		for _, event := range session.Events(t) {
+			if match(event) {
+				return event
+			}
+		}
+		if session.Conn.IsClosed() {
+			t.Fatalf("session %s of user %s was closed while waiting for %s", session.GetSessionId(), session.GetUserId(), description)
+			return neogate.Event{}
+		}
+
+		select {
+		case <-wait:
+		case <-timeout:
+			t.Fatalf("session %s of user %s didn't receive %s", session.GetSessionId(), session.GetUserId(), description)
+			return neogate.Event{}
+		}
+	}
+}
+
+func (harness *Harness[T]) timeout() time.Duration {
+	if harness.Timeout <= 0 {
+		return time.Second
+	}
+	return harness.Timeout
+}
+
+// Convert the data of an event to a type (e.g. the response struct of a handler).
+func Data[R any](t testing.TB, event neogate.Event) R {
+	t.Helper()
+
+	var data R
+	encoded, err := sonic.Marshal(event.Data)
+	if err == nil {
+		err = sonic.Unmarshal(encoded, &data)
+	}
+	if err != nil {
+		t.Fatalf("couldn't convert data of event %s: %s", event.Name, err)
+	}
+	return data
+}
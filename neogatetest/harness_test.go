@@ -0,0 +1,242 @@
+package neogatetest_test
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+	"github.com/Liphium/neogate/neogatetest"
+)
+
+type echoAction struct {
+	Message string `json:"message"`
+}
+
+// Create a harness for an instance with a few actions to test against:
+//   - echo responds with the message it got
+//   - notify sends the message to the room adapter, which passes it on to the user of the session
+//   - leave disconnects the session
+//   - kick disconnects the session with the message as the close reason
+func newHarness(t *testing.T) *neogatetest.Harness[neogate.None] {
+	t.Helper()
+
+	instance := neogate.Setup(neogate.Config[neogate.None]{
+		SessionEnterNetworkHandler: func(*neogate.Session[neogate.None], neogate.None) bool {
+			return false
+		},
+		SessionDisconnectHandler: func(*neogate.Session[neogate.None]) {},
+		SessionAdapterHandler: func(userId string, sessionId string) (string, string) {
+			return "user:" + userId, "session:" + userId + ":" + sessionId
+		},
+		EncodingMiddleware: neogate.DefaultEncodingMiddleware[neogate.None],
+		DecodingMiddleware: neogate.DefaultDecodingMiddleware[neogate.None],
+	})
+	t.Cleanup(instance.Close)
+
+	neogate.CreateHandlerFor(instance, "echo", func(c *neogate.Context[neogate.None], action echoAction) neogate.Event {
+		return neogate.NormalResponse(c, action)
+	})
+	neogate.CreateHandlerFor(instance, "notify", func(c *neogate.Context[neogate.None], action echoAction) neogate.Event {
+		if err := c.Instance.SendOne("room", neogate.Event{Name: "notification", Data: action}); err != nil {
+			return neogate.ErrorResponse(c, "couldn't notify", err)
+		}
+		return neogate.SuccessResponse(c)
+	})
+	neogate.CreateHandlerFor(instance, "leave", func(c *neogate.Context[neogate.None], _ any) neogate.Event {
+		c.Instance.DisconnectSession(c.Session.GetUserId(), c.Session.GetSessionId())
+		return neogate.SuccessResponse(c)
+	})
+	neogate.CreateHandlerFor(instance, "kick", func(c *neogate.Context[neogate.None], action echoAction) neogate.Event {
+		c.Instance.DisconnectSessionWithReason(c.Session.GetUserId(), c.Session.GetSessionId(), action.Message)
+		return neogate.SuccessResponse(c)
+	})
+
+	_, err := instance.Adapt(neogate.CreateAction{
+		ID: "room",
+		OnEvent: func(c *neogate.AdapterContext) error {
+			return instance.SendEventToUser("bob", *c.Event)
+		},
+		OnError: func(error) {},
+	})
+	if err != nil {
+		t.Fatalf("couldn't register room adapter: %s", err)
+	}
+	return neogatetest.New(instance)
+}
+
+func TestSendExpectResponse(t *testing.T) {
+	harness := newHarness(t)
+	session := harness.Connect(t, "alice", neogate.None{})
+	harness.Connect(t, "bob", neogate.None{}) // Receives the notifications of the room
+
+	tests := []struct {
+		name    string
+		action  string
+		data    any
+		success bool
+		message string
+	}{
+		{name: "echo", action: "echo", data: echoAction{Message: "hello"}, message: "hello"},
+		{name: "invalid data", action: "echo", data: "not an object", message: "Invalid request."},
+		{name: "adapter", action: "notify", data: echoAction{Message: "hi"}, success: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responseId := session.Send(t, test.action, test.data)
+			response := session.ExpectResponse(t, responseId)
+			if want := "res:" + test.action + ":" + responseId; response.Name != want {
+				t.Fatalf("response is named %s, want %s", response.Name, want)
+			}
+
+			data := neogatetest.Data[struct {
+				Success bool   `json:"success"`
+				Message string `json:"message"`
+			}](t, response)
+			if data.Success != test.success || data.Message != test.message {
+				t.Fatalf("response data = %+v, want success %t and message %q", data, test.success, test.message)
+			}
+		})
+	}
+}
+
+func TestExpectEventForUser(t *testing.T) {
+	harness := newHarness(t)
+	alice := harness.Connect(t, "alice", neogate.None{})
+	bob := []*neogatetest.Session[neogate.None]{
+		harness.Connect(t, "bob", neogate.None{}),
+		harness.Connect(t, "bob", neogate.None{}),
+		harness.Connect(t, "bob", neogate.None{}),
+	}
+
+	// Closed sessions are skipped
+	bob[2].Close()
+
+	alice.ExpectResponse(t, alice.Send(t, "notify", echoAction{Message: "hi"}))
+	event := harness.ExpectEventForUser(t, "bob", "notification")
+	if data := neogatetest.Data[echoAction](t, event); data.Message != "hi" {
+		t.Fatalf("notification data = %+v", data)
+	}
+	for _, session := range bob[:2] {
+		if events := session.Events(t); len(events) != 1 || events[0].Name != "notification" {
+			t.Fatalf("session %s received %v", session.GetSessionId(), events)
+		}
+	}
+	alice.ExpectNoEvent(t, "notification", 50*time.Millisecond)
+
+	if sessions := harness.Sessions("bob"); len(sessions) != 3 {
+		t.Fatalf("harness has %d sessions of bob, want 3", len(sessions))
+	}
+}
+
+func TestExpectDisconnected(t *testing.T) {
+	harness := newHarness(t)
+	session := harness.Connect(t, "alice", neogate.None{})
+	other := harness.Connect(t, "alice", neogate.None{})
+
+	session.Send(t, "leave", nil)
+	session.ExpectDisconnected(t)
+	if !session.Conn.IsClosed() {
+		t.Fatal("connection wasn't closed")
+	}
+	if harness.Instance.ExistsConnection("alice", session.GetSessionId()) {
+		t.Fatal("session still exists")
+	}
+
+	if _, ok := session.Conn.CloseReason(); ok {
+		t.Fatal("session was closed with a reason")
+	}
+
+	// The other session isn't affected
+	other.ExpectResponse(t, other.Send(t, "echo", echoAction{Message: "still here"}))
+	if sessions := harness.Instance.GetSessions("alice"); !slices.Equal(sessions, []string{other.GetSessionId()}) {
+		t.Fatalf("sessions of alice = %v", sessions)
+	}
+
+	// Closing like a client removes the session as well
+	other.Close()
+	other.ExpectDisconnected(t)
+	if harness.Instance.SessionCount() != 0 {
+		t.Fatalf("instance still has %d sessions", harness.Instance.SessionCount())
+	}
+}
+
+func TestExpectCloseReason(t *testing.T) {
+	harness := newHarness(t)
+	session := harness.Connect(t, "alice", neogate.None{})
+
+	session.Send(t, "kick", echoAction{Message: "bye"})
+	session.ExpectCloseReason(t, "bye")
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	conn := neogatetest.NewConn()
+	read := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadMessage()
+		read <- err
+	}()
+
+	// Reads that are already waiting use the new deadline
+	conn.SetReadDeadline(time.Now().Add(time.Hour))
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	select {
+	case err := <-read:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("read returned %v, want %v", err, os.ErrDeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read didn't time out")
+	}
+
+	// Messages are read as usual once the deadline is gone
+	conn.SetReadDeadline(time.Time{})
+	go func() {
+		_, msg, err := conn.ReadMessage()
+		if string(msg) != "hello" {
+			err = errors.New("read " + string(msg))
+		}
+		read <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := conn.Inject([]byte("hello")); err != nil {
+		t.Fatalf("couldn't inject message: %s", err)
+	}
+	if err := <-read; err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	harness := newHarness(t)
+
+	// The instance reverses messages in both directions, the client of the harness has to do the same
+	reverse := func(message []byte) ([]byte, error) {
+		reversed := slices.Clone(message)
+		slices.Reverse(reversed)
+		return reversed, nil
+	}
+	harness.Instance.Config.EncodingMiddleware = func(_ *neogate.Session[neogate.None], _ *neogate.Instance[neogate.None], message []byte) ([]byte, error) {
+		return reverse(message)
+	}
+	harness.Instance.Config.DecodingMiddleware = func(_ *neogate.Session[neogate.None], _ *neogate.Instance[neogate.None], message []byte) ([]byte, error) {
+		return reverse(message)
+	}
+	harness.Encode = reverse
+	harness.Decode = reverse
+
+	session := harness.Connect(t, "alice", neogate.None{})
+	response := session.ExpectResponse(t, session.Send(t, "echo", echoAction{Message: "hello"}))
+	if data := neogatetest.Data[echoAction](t, response); data.Message != "hello" {
+		t.Fatalf("response data = %+v", data)
+	}
+
+	written := session.Conn.Written()
+	if len(written) != 1 || !strings.HasPrefix(string(written[0]), "}") {
+		t.Fatalf("message wasn't encoded: %q", written)
+	}
+}
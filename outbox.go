@@ -0,0 +1,311 @@
+package neogate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// An event waiting in the outbox of a user.
+type OutboxEntry struct {
+	Message   sonic.NoCopyRawMessage `json:"message"`    // The event as json (stored like it was sent, so later changes to its data don't matter)
+	ExpiresAt time.Time              `json:"expires_at"` // When the event is dropped (zero = never)
+}
+
+func (entry OutboxEntry) expired(now time.Time) bool {
+	return !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt)
+}
+
+// Storage for the events of users that weren't connected when the events were sent.
+type OutboxStore interface {
+
+	// Add an event to the end of the outbox of the user.
+	Push(userId string, entry OutboxEntry) error
+
+	// Get the events in the outbox of the user (oldest first, including expired ones) without removing them.
+	Peek(userId string) ([]OutboxEntry, error)
+
+	// Remove the first count events from the outbox of the user (called once the events returned by Peek were delivered).
+	Ack(userId string, count int) error
+}
+
+// How often stores remove the outboxes that only contain expired events.
+var outboxSweepInterval = time.Hour
+
+type memoryOutboxStore struct {
+	mutex     *sync.Mutex
+	outboxes  map[string][]OutboxEntry // UserId -> events
+	lastSweep time.Time
+}
+
+// Create an outbox store that keeps the events in memory (they're lost on restart).
+func NewMemoryOutboxStore() OutboxStore {
+	return &memoryOutboxStore{
+		mutex:     &sync.Mutex{},
+		outboxes:  map[string][]OutboxEntry{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (store *memoryOutboxStore) Push(userId string, entry OutboxEntry) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Remove the outboxes of users that didn't connect until all of their events expired
+	now := time.Now()
+	if now.Sub(store.lastSweep) > outboxSweepInterval {
+		for id, entries := range store.outboxes {
+			if len(unexpired(entries, now)) == 0 {
+				delete(store.outboxes, id)
+			}
+		}
+		store.lastSweep = now
+	}
+
+	store.outboxes[userId] = append(store.outboxes[userId], entry)
+	return nil
+}
+
+func (store *memoryOutboxStore) Peek(userId string) ([]OutboxEntry, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return slices.Clone(store.outboxes[userId]), nil
+}
+
+func (store *memoryOutboxStore) Ack(userId string, count int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	entries := store.outboxes[userId]
+	if count >= len(entries) {
+		delete(store.outboxes, userId)
+		return nil
+	}
+	store.outboxes[userId] = slices.Clone(entries[count:])
+	return nil
+}
+
+type fileOutboxStore struct {
+	mutex     *sync.Mutex
+	directory string
+	lastSweep time.Time
+}
+
+// Create an outbox store that keeps the events in files in the directory (one file with a json line per event for every user).
+func NewFileOutboxStore(directory string) (OutboxStore, error) {
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &fileOutboxStore{
+		mutex:     &sync.Mutex{},
+		directory: directory,
+		lastSweep: time.Now(),
+	}, nil
+}
+
+func (store *fileOutboxStore) path(userId string) string {
+	return filepath.Join(store.directory, base64.RawURLEncoding.EncodeToString([]byte(userId))+".jsonl")
+}
+
+func (store *fileOutboxStore) Push(userId string, entry OutboxEntry) error {
+	lines, err := outboxLines([]OutboxEntry{entry})
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if time.Since(store.lastSweep) > outboxSweepInterval {
+		store.sweep()
+	}
+
+	file, err := os.OpenFile(store.path(userId), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(lines); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Removes the events by writing the remaining lines to another file first, so a crash doesn't lose the outbox
+// (the events are delivered again instead).
+func (store *fileOutboxStore) Ack(userId string, count int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	path := store.path(userId)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Skip the lines of the acknowledged events (broken lines in between are dropped with them)
+	remaining := content
+	for count > 0 && len(remaining) > 0 {
+		line, rest, _ := bytes.Cut(remaining, []byte{'\n'})
+		remaining = rest
+
+		var entry OutboxEntry
+		if sonic.Unmarshal(line, &entry) == nil {
+			count--
+		}
+	}
+	if len(bytes.TrimSpace(remaining)) == 0 {
+		return os.Remove(path)
+	}
+
+	temp := path + ".tmp"
+	file, err := os.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(remaining); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// Marshal the events to the lines of an outbox file.
+func outboxLines(entries []OutboxEntry) ([]byte, error) {
+	lines := []byte{}
+	for _, entry := range entries {
+		line, err := sonic.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	return lines, nil
+}
+
+func (store *fileOutboxStore) Peek(userId string) ([]OutboxEntry, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	entries, err := readOutboxFile(store.path(userId))
+	if errors.Is(err, os.ErrNotExist) {
+		return []OutboxEntry{}, nil
+	}
+	return entries, err
+}
+
+// Remove the files that only contain expired events (needs the mutex to be locked).
+func (store *fileOutboxStore) sweep() {
+	store.lastSweep = time.Now()
+
+	files, err := os.ReadDir(store.directory)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".jsonl") {
+			continue
+		}
+
+		path := filepath.Join(store.directory, file.Name())
+		entries, err := readOutboxFile(path)
+		if err == nil && len(unexpired(entries, store.lastSweep)) == 0 {
+			os.Remove(path)
+		}
+	}
+}
+
+// Read the events in an outbox file (lines that can't be parsed, e.g. because of a crash while writing, are skipped).
+func readOutboxFile(path string) ([]OutboxEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []OutboxEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		var entry OutboxEntry
+		if err := sonic.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func unexpired(entries []OutboxEntry, now time.Time) []OutboxEntry {
+	result := []OutboxEntry{}
+	for _, entry := range entries {
+		if !entry.expired(now) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Store the event in the outbox of the user in case outboxes are enabled (Config.Outbox, needs the user to be locked using lockUser).
+func (instance *Instance[T]) storeInOutbox(userId string, event Event, ttl time.Duration) error {
+	msg, err := sonic.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	entry := OutboxEntry{Message: msg}
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+	return instance.Config.Outbox.Push(userId, entry)
+}
+
+// Send the events in the outbox of the user to the session in the order they were sent in (needs the user to be locked using lockUser).
+//
+// Events are only removed from the outbox once they were delivered, so the ones that weren't are kept for the next session.
+func (instance *Instance[T]) deliverOutbox(session *Session[T]) {
+	entries, err := instance.Config.Outbox.Peek(session.userId)
+	if err != nil {
+		instance.ReportSessionError(session, "couldn't load outbox", err)
+		return
+	}
+
+	now := time.Now()
+	handled := 0
+	for _, entry := range entries {
+		if !entry.expired(now) {
+			if err := instance.sendToSessionWS(session, entry.Message); err != nil {
+				instance.ReportSessionError(session, "couldn't deliver outbox", err)
+				break
+			}
+		}
+		handled++
+	}
+
+	if handled == 0 {
+		return
+	}
+	if err := instance.Config.Outbox.Ack(session.userId, handled); err != nil {
+		instance.ReportSessionError(session, "couldn't remove delivered events from outbox", err)
+	}
+}
@@ -0,0 +1,242 @@
+package neogate_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+	"github.com/Liphium/neogate/neogatetest"
+)
+
+func outboxEntry(name string, expiresAt time.Time) neogate.OutboxEntry {
+	return neogate.OutboxEntry{
+		Message:   []byte(`{"name":"` + name + `","data":null}`),
+		ExpiresAt: expiresAt,
+	}
+}
+
+func outboxNames(entries []neogate.OutboxEntry) []string {
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, string(entry.Message))
+	}
+	return names
+}
+
+func TestOutboxStore(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	a, b, c := outboxEntry("a", time.Time{}), outboxEntry("b", future), outboxEntry("c", past)
+
+	stores := map[string]func(t *testing.T) neogate.OutboxStore{
+		"memory": func(t *testing.T) neogate.OutboxStore {
+			return neogate.NewMemoryOutboxStore()
+		},
+		"file": func(t *testing.T) neogate.OutboxStore {
+			store, err := neogate.NewFileOutboxStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("couldn't create store: %s", err)
+			}
+			return store
+		},
+	}
+	tests := []struct {
+		name  string
+		user  string
+		push  []neogate.OutboxEntry
+		acked int                   // Amount of events acknowledged after peeking
+		want  []neogate.OutboxEntry // Events left after the ack
+	}{
+		{name: "empty", user: "alice", want: []neogate.OutboxEntry{}},
+		{name: "nothing acknowledged", user: "alice", push: []neogate.OutboxEntry{a, b, c}, want: []neogate.OutboxEntry{a, b, c}},
+		{name: "partially acknowledged", user: "alice", push: []neogate.OutboxEntry{a, b, c}, acked: 2, want: []neogate.OutboxEntry{c}},
+		{name: "all acknowledged", user: "alice", push: []neogate.OutboxEntry{a, b, c}, acked: 3, want: []neogate.OutboxEntry{}},
+		{name: "more acknowledged than stored", user: "alice", push: []neogate.OutboxEntry{a}, acked: 2, want: []neogate.OutboxEntry{}},
+		{name: "user ids that aren't file names", user: "../alice/\x00", push: []neogate.OutboxEntry{a}, want: []neogate.OutboxEntry{a}},
+	}
+
+	for storeName, newStore := range stores {
+		for _, test := range tests {
+			t.Run(storeName+"/"+test.name, func(t *testing.T) {
+				store := newStore(t)
+				for _, entry := range test.push {
+					if err := store.Push(test.user, entry); err != nil {
+						t.Fatalf("couldn't push: %s", err)
+					}
+				}
+
+				// Other users shouldn't be affected
+				if err := store.Push("bob", outboxEntry("other", time.Time{})); err != nil {
+					t.Fatalf("couldn't push: %s", err)
+				}
+
+				// Peeking doesn't remove anything and keeps the expired events for the caller to skip
+				for range 2 {
+					entries, err := store.Peek(test.user)
+					if err != nil {
+						t.Fatalf("couldn't peek: %s", err)
+					}
+					if got, want := outboxNames(entries), outboxNames(test.push); !slices.Equal(got, want) {
+						t.Fatalf("peeked %q, want %q", got, want)
+					}
+					for i, entry := range entries {
+						if !entry.ExpiresAt.Equal(test.push[i].ExpiresAt) {
+							t.Fatalf("entry %d expires at %s, want %s", i, entry.ExpiresAt, test.push[i].ExpiresAt)
+						}
+					}
+				}
+
+				if err := store.Ack(test.user, test.acked); err != nil {
+					t.Fatalf("couldn't ack: %s", err)
+				}
+				entries, err := store.Peek(test.user)
+				if err != nil {
+					t.Fatalf("couldn't peek: %s", err)
+				}
+				if got, want := outboxNames(entries), outboxNames(test.want); !slices.Equal(got, want) {
+					t.Fatalf("left %q after ack, want %q", got, want)
+				}
+				if entries, err := store.Peek("bob"); err != nil || len(entries) != 1 {
+					t.Fatalf("outbox of other user has %d entries (%v)", len(entries), err)
+				}
+			})
+		}
+	}
+}
+
+func TestFileOutboxStoreSkipsBrokenLines(t *testing.T) {
+	directory := t.TempDir()
+	store, err := neogate.NewFileOutboxStore(directory)
+	if err != nil {
+		t.Fatalf("couldn't create store: %s", err)
+	}
+	if err := store.Push("alice", outboxEntry("a", time.Time{})); err != nil {
+		t.Fatalf("couldn't push: %s", err)
+	}
+
+	// Simulate a crash while writing the second event
+	files, err := filepath.Glob(filepath.Join(directory, "*.jsonl"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one outbox file, found %q (%v)", files, err)
+	}
+	file, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("couldn't open outbox file: %s", err)
+	}
+	file.WriteString(`{"message":{"name":"b"`)
+	file.Close()
+
+	if err := store.Push("alice", outboxEntry("c", time.Time{})); err != nil {
+		t.Fatalf("couldn't push: %s", err)
+	}
+
+	entries, err := store.Peek("alice")
+	if err != nil {
+		t.Fatalf("couldn't peek: %s", err)
+	}
+	if got, want := outboxNames(entries), outboxNames([]neogate.OutboxEntry{outboxEntry("a", time.Time{})}); !slices.Equal(got, want) {
+		t.Fatalf("peeked %q, want %q", got, want)
+	}
+
+	// The broken line isn't counted as an event when acknowledging
+	if err := store.Ack("alice", 1); err != nil {
+		t.Fatalf("couldn't ack: %s", err)
+	}
+	if entries, err := store.Peek("alice"); err != nil || len(entries) != 0 {
+		t.Fatalf("outbox has %d entries after ack (%v)", len(entries), err)
+	}
+}
+
+func TestOutboxDelivery(t *testing.T) {
+	store, err := neogate.NewFileOutboxStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("couldn't create store: %s", err)
+	}
+	harness := newHarness(t, neogate.Config[neogate.None]{Outbox: store})
+
+	// Events sent while alice is offline are delivered once she connects, before new ones
+	for _, name := range []string{"first", "second"} {
+		if err := harness.Instance.SendEventToUser("alice", neogate.Event{Name: name, Data: map[string]string{"event": name}}); err != nil {
+			t.Fatalf("couldn't send %s: %s", name, err)
+		}
+	}
+
+	session := harness.Connect(t, "alice", neogate.None{})
+	if err := harness.Instance.SendEventToUser("alice", neogate.Event{Name: "live"}); err != nil {
+		t.Fatalf("couldn't send live event: %s", err)
+	}
+	session.ExpectEvent(t, "live")
+
+	names := []string{}
+	for _, event := range session.Events(t) {
+		names = append(names, event.Name)
+	}
+	if want := []string{"first", "second", "live"}; !slices.Equal(names, want) {
+		t.Fatalf("received %q, want %q", names, want)
+	}
+	if data := neogatetest.Data[map[string]string](t, session.Events(t)[1]); data["event"] != "second" {
+		t.Fatalf("data of second event = %v", data)
+	}
+
+	// Later sessions don't get the events again
+	other := harness.Connect(t, "alice", neogate.None{})
+	other.ExpectNoEvent(t, "first", 50*time.Millisecond)
+}
+
+func TestOutboxPartialDelivery(t *testing.T) {
+	store, err := neogate.NewFileOutboxStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("couldn't create store: %s", err)
+	}
+
+	// Writing the event named broken fails until fixed is closed
+	fixed := make(chan struct{})
+	harness := newHarness(t, neogate.Config[neogate.None]{
+		Outbox: store,
+		EncodingMiddleware: func(_ *neogate.Session[neogate.None], _ *neogate.Instance[neogate.None], message []byte) ([]byte, error) {
+			select {
+			case <-fixed:
+			default:
+				if bytes.Contains(message, []byte(`"broken"`)) {
+					return nil, errors.New("broken")
+				}
+			}
+			return message, nil
+		},
+	})
+	for _, name := range []string{"first", "broken", "last"} {
+		if err := harness.Instance.SendEventToUser("alice", neogate.Event{Name: name}); err != nil {
+			t.Fatalf("couldn't send %s: %s", name, err)
+		}
+	}
+
+	// Only the event that was delivered is removed
+	session := harness.Connect(t, "alice", neogate.None{})
+	session.ExpectEvent(t, "first")
+	session.ExpectNoEvent(t, "last", 50*time.Millisecond)
+	entries, err := store.Peek("alice")
+	if err != nil {
+		t.Fatalf("couldn't peek: %s", err)
+	}
+	if got := outboxNames(entries); len(got) != 2 {
+		t.Fatalf("outbox contains %q after partial delivery, want the last 2 events", got)
+	}
+	session.Close()
+	session.ExpectDisconnected(t)
+
+	close(fixed)
+	next := harness.Connect(t, "alice", neogate.None{})
+	next.ExpectEvent(t, "last")
+	names := []string{}
+	for _, event := range next.Events(t) {
+		names = append(names, event.Name)
+	}
+	if want := []string{"broken", "last"}; !slices.Equal(names, want) {
+		t.Fatalf("next session received %q, want %q", names, want)
+	}
+}
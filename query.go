@@ -0,0 +1,151 @@
+package neogate
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/bytedance/sonic"
+)
+
+// Selects sessions for QuerySessions and BroadcastWhere.
+type SessionQuery[T any] struct {
+	Tags  []string                       // Sessions need all of these tags (see Config.SessionTags), looked up using the index
+	Where func(session *Session[T]) bool // Checked for every session that has the tags (all of them match in case it's nil)
+}
+
+// Index of the sessions by their tags.
+type tagIndex[T any] struct {
+	mutex *sync.RWMutex
+	tags  map[string]map[string]*Session[T] // Tag -> UserId:sessionId -> session
+}
+
+func newTagIndex[T any]() *tagIndex[T] {
+	return &tagIndex[T]{
+		mutex: &sync.RWMutex{},
+		tags:  map[string]map[string]*Session[T]{},
+	}
+}
+
+// Compute the tags of the session again (e.g. after its data changed). Does nothing in case Config.SessionTags isn't specified.
+func (instance *Instance[T]) RetagSession(session *Session[T]) {
+	if instance.Config.SessionTags == nil {
+		return
+	}
+	tags := instance.Config.SessionTags(session)
+
+	index := instance.tagIndex
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	// Checked while locked so a session that's being removed isn't added again
+	if !instance.ExistsConnection(session.userId, session.sessionId) {
+		return
+	}
+
+	index.remove(session)
+	key := getKey(session.userId, session.sessionId)
+	for _, tag := range tags {
+		if index.tags[tag] == nil {
+			index.tags[tag] = map[string]*Session[T]{}
+		}
+		index.tags[tag][key] = session
+	}
+	session.setTags(tags)
+}
+
+// Remove the session from the index.
+func (instance *Instance[T]) untagSession(session *Session[T]) {
+	index := instance.tagIndex
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	index.remove(session)
+}
+
+// Needs the mutex to be locked.
+func (index *tagIndex[T]) remove(session *Session[T]) {
+	key := getKey(session.userId, session.sessionId)
+	for _, tag := range session.tags {
+		delete(index.tags[tag], key)
+		if len(index.tags[tag]) == 0 {
+			delete(index.tags, tag)
+		}
+	}
+	session.setTags(nil)
+}
+
+// Get the tags of the session (see Config.SessionTags).
+func (session *Session[T]) GetTags() []string {
+	session.dataMutex.RLock()
+	defer session.dataMutex.RUnlock()
+
+	return slices.Clone(session.tags)
+}
+
+// Only changed while the mutex of the index is locked (so the index can read them without locking the session).
+func (session *Session[T]) setTags(tags []string) {
+	session.dataMutex.Lock()
+	defer session.dataMutex.Unlock()
+
+	session.tags = tags
+}
+
+// All sessions matching the query.
+func (instance *Instance[T]) QuerySessions(query SessionQuery[T]) []*Session[T] {
+	sessions := []*Session[T]{}
+	for _, session := range instance.tagged(query.Tags) {
+		if query.Where == nil || query.Where(session) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// Sessions with all of the tags (all sessions in case there are no tags).
+func (instance *Instance[T]) tagged(tags []string) []*Session[T] {
+	sessions := []*Session[T]{}
+	if len(tags) == 0 {
+		instance.connectionsCache.Range(func(_, value any) bool {
+			sessions = append(sessions, value.(*Session[T]))
+			return true
+		})
+		return sessions
+	}
+
+	index := instance.tagIndex
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	// Start with the tag that has the fewest sessions
+	smallest := index.tags[tags[0]]
+	for _, tag := range tags[1:] {
+		if len(index.tags[tag]) < len(smallest) {
+			smallest = index.tags[tag]
+		}
+	}
+
+	for key, session := range smallest {
+		matches := true
+		for _, tag := range tags {
+			if _, ok := index.tags[tag][key]; !ok {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// Send an event to all sessions matching the query. The event is only marshaled once
+// (and only encoded once in case Config.SharedEncoding is enabled).
+func (instance *Instance[T]) BroadcastWhere(query SessionQuery[T], event Event) (BroadcastResult, error) {
+	msg, err := sonic.Marshal(instance.stampEvent(event))
+	if err != nil {
+		return BroadcastResult{}, err
+	}
+
+	return instance.broadcast(instance.QuerySessions(query), msg), nil
+}
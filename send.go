@@ -2,22 +2,42 @@ package neogate
 
 import (
 	"errors"
+	"time"
 
 	"github.com/bytedance/sonic"
-	"github.com/gofiber/websocket/v2"
+	"github.com/fasthttp/websocket"
+)
+
+var (
+	ErrNoSessions    = errors.New("no sessions found")
+	ErrSessionClosed = errors.New("session closed")
 )
 
 // SendEventToUser sends the event to all sessions connected to the userId
+//
+// The event is stored in the outbox of the user in case it isn't connected and Config.Outbox is specified (for Config.OutboxTTL).
 func (instance *Instance[T]) SendEventToUser(userId string, event Event) error {
+	return instance.SendEventToUserWithTTL(userId, event, instance.Config.OutboxTTL)
+}
+
+// SendEventToUserWithTTL sends the event to all sessions connected to the userId.
+//
+// The event is stored in the outbox of the user in case it isn't connected and Config.Outbox is specified (for ttl, 0 = forever).
+func (instance *Instance[T]) SendEventToUserWithTTL(userId string, event Event, ttl time.Duration) error {
+
+	// Make sure the first session of the user doesn't connect between checking for sessions and storing the event
+	if instance.Config.Outbox != nil {
+		unlock := instance.lockUser(userId)
+		defer unlock()
+	}
 
-	sessionList, ok := instance.sessionsCache.sessions.Load(userId)
-	if !ok {
-		return errors.New("no sessions found")
+	sessionIds := instance.GetSessions(userId)
+	if len(sessionIds) == 0 {
+		if instance.Config.Outbox != nil {
+			return instance.storeInOutbox(userId, instance.stampEvent(event), ttl)
+		}
+		return ErrNoSessions
 	}
-	sessions := sessionList.(*SessionsList)
-	sessions.mutex.RLock()
-	sessionIds := sessions.sessions
-	sessions.mutex.RUnlock()
 
 	adapterIds := []string{}
 	for _, sessionId := range sessionIds {
@@ -33,6 +53,7 @@ func (instance *Instance[T]) SendEventToUser(userId string, event Event) error {
 
 // Sends an event to a specific Session
 func (instance *Instance[T]) SendEventToSession(c *Session[T], event Event) error {
+	event = instance.stampEvent(event)
 	msg, err := sonic.Marshal(event)
 	if err != nil {
 		return err
@@ -49,15 +70,25 @@ func (instance *Instance[T]) sendToSessionWS(session *Session[T], msg []byte) er
 		return err
 	}
 
+	return session.writeMessage(msg)
+}
+
+// Write an encoded message to the connection of the session.
+func (session *Session[T]) writeMessage(msg []byte) error {
+
 	// Lock and unlock mutex after writing
 	session.wsMutex.Lock()
 	defer session.wsMutex.Unlock()
 
+	if session.closed {
+		return ErrSessionClosed
+	}
 	return session.conn.WriteMessage(websocket.BinaryMessage, msg)
 }
 
-// Send an event to all adapters
+// Send an event to all adapters (ids are used as they are, see SendPattern for patterns)
 func (instance *Instance[T]) Send(adapters []string, event Event) error {
+	event = instance.stampEvent(event)
 	msg, err := sonic.Marshal(event)
 	if err != nil {
 		return err
@@ -65,7 +96,7 @@ func (instance *Instance[T]) Send(adapters []string, event Event) error {
 
 	adapterErr := map[string]error{}
 	for _, adapter := range adapters {
-		err := instance.AdapterReceive(adapter, event, msg)
+		err := instance.recordAndReceive(adapter, event, msg)
 		if err != nil {
 			adapterErr[adapter] = err
 		}
@@ -80,6 +111,15 @@ func (instance *Instance[T]) Send(adapters []string, event Event) error {
 	}
 }
 
+// Send an event to all adapters matching the patterns (see MatchAdapters). Returns ErrAdapterNotFound in case none match.
+func (instance *Instance[T]) SendPattern(patterns []string, event Event) error {
+	adapters := instance.expandAdapters(patterns)
+	if len(adapters) == 0 {
+		return ErrAdapterNotFound
+	}
+	return instance.Send(adapters, event)
+}
+
 // Sends an event to the account.
 //
 // Only returns errors for encoding, not retrieval (cause adapters handle that themselves).
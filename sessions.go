@@ -3,37 +3,76 @@ package neogate
 import (
 	"slices"
 	"sync"
-
-	"github.com/gofiber/websocket/v2"
+	"sync/atomic"
+	"time"
 )
 
+// Conn is the connection of a session (implemented by *websocket.Conn).
+//
+// Message types are the ones used by websocket (e.g. websocket.BinaryMessage).
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
 // Used to provide information for session creation
 type SessionInfo[T any] struct {
-	UserId    string // Identifier of the user
-	sessionId string // Identifier of this user session
-	Data      T      // Session data you can decide how to fill
+	UserId    string    // Identifier of the user
+	sessionId string    // Identifier of this user session
+	Data      T         // Session data you can decide how to fill
+	ExpiresAt time.Time // When the session expires in case it isn't refreshed using the reauth action (zero = never)
+
+	pending       *HandshakeRequest // Request of a connection that still has to authenticate using its first message
+	authenticated bool              // If the session was authenticated using its first message
+	metadata      *SessionMetadata  // Captured from the handshake request
+	slot          *admissionSlot    // Reserved by the admission control (nil in case it's disabled)
 }
 
 // Convert the session information to a session that can be used by neogate.
-func (sessionInfo SessionInfo[T]) toSession(conn *websocket.Conn) *Session[T] {
+func (sessionInfo SessionInfo[T]) toSession(conn Conn) *Session[T] {
+
+	// Sessions that weren't accepted by a transport don't have any metadata
+	metadata := SessionMetadata{Headers: map[string]string{}, Query: map[string]string{}}
+	if sessionInfo.metadata != nil {
+		metadata = *sessionInfo.metadata
+	}
+	metadata.ConnectedAt = time.Now()
+	lastActive := &atomic.Int64{}
+	lastActive.Store(metadata.ConnectedAt.UnixNano())
 
 	return &Session[T]{
-		conn:      conn,
-		userId:    sessionInfo.UserId,
-		sessionId: sessionInfo.sessionId,
-		data:      sessionInfo.Data,
-		wsMutex:   &sync.Mutex{},
-		dataMutex: &sync.RWMutex{},
+		conn:        conn,
+		userId:      sessionInfo.UserId,
+		sessionId:   sessionInfo.sessionId,
+		data:        sessionInfo.Data,
+		wsMutex:     &sync.Mutex{},
+		dataMutex:   &sync.RWMutex{},
+		expiryMutex: &sync.Mutex{},
+		metadata:    &metadata,
+		lastActive:  lastActive,
+		slot:        sessionInfo.slot,
 	}
 }
 
 type Session[T any] struct {
-	conn      *websocket.Conn
-	userId    string
-	sessionId string
-	data      T
-	dataMutex *sync.RWMutex
-	wsMutex   *sync.Mutex
+	conn       Conn
+	userId     string
+	sessionId  string
+	data       T
+	dataMutex  *sync.RWMutex
+	wsMutex    *sync.Mutex
+	closed     bool // If the connection can't be used anymore (guarded by wsMutex, transports may reuse it after Run returned)
+	metadata   *SessionMetadata
+	lastActive *atomic.Int64  // Unix nanoseconds
+	tags       []string       // Tags in the index (see Config.SessionTags)
+	slot       *admissionSlot // Given back once the session is closed
+
+	expiryMutex *sync.Mutex
+	expiresAt   time.Time
+	warnTimer   *time.Timer
+	expireTimer *time.Timer
 }
 
 func (session *Session[T]) GetData() T {
@@ -58,6 +97,49 @@ func (session *Session[T]) GetSessionId() string {
 	return session.sessionId
 }
 
+// Mutexes of users, for things that have to happen together with adding a session of the user.
+type userLocks struct {
+	mutex *sync.Mutex
+	locks map[string]*userLock // UserId -> lock (only while someone holds or waits for it)
+}
+
+type userLock struct {
+	mutex *sync.Mutex
+	users int // Amount of goroutines holding or waiting for the lock
+}
+
+func newUserLocks() *userLocks {
+	return &userLocks{
+		mutex: &sync.Mutex{},
+		locks: map[string]*userLock{},
+	}
+}
+
+// Lock the user. Call the returned function to unlock it again.
+func (instance *Instance[T]) lockUser(userId string) func() {
+	locks := instance.userLocks
+	locks.mutex.Lock()
+	lock, ok := locks.locks[userId]
+	if !ok {
+		lock = &userLock{mutex: &sync.Mutex{}}
+		locks.locks[userId] = lock
+	}
+	lock.users++
+	locks.mutex.Unlock()
+
+	lock.mutex.Lock()
+	return func() {
+		lock.mutex.Unlock()
+
+		locks.mutex.Lock()
+		if lock.users--; lock.users == 0 {
+			delete(locks.locks, userId)
+		}
+		locks.mutex.Unlock()
+	}
+}
+
+// Add the session and make room for it in case the user has too many sessions (needs the user to be locked using lockUser).
 func (instance *Instance[T]) addSession(session *Session[T]) {
 
 	// Add the session
@@ -65,8 +147,11 @@ func (instance *Instance[T]) addSession(session *Session[T]) {
 
 	// If the session is not yet added, make sure to add it to the list
 	if !loaded {
+		instance.sessionCount.Add(1)
 		instance.createSession(session)
 	}
+
+	instance.evictSessions(session)
 }
 
 func getKey(id string, session string) string {
@@ -76,8 +161,12 @@ func getKey(id string, session string) string {
 func (instance *Instance[T]) createSession(session *Session[T]) {
 
 	_, sessionAdapterName := instance.Config.SessionAdapterHandler(session.GetUserId(), session.GetSessionId())
-	instance.Adapt(CreateAction{
-		ID: sessionAdapterName,
+	_, err := instance.Adapt(CreateAction{
+		ID:           sessionAdapterName,
+		Metadata:     session.metadata,
+		OwnerUser:    session.userId,
+		OwnerSession: session.sessionId,
+		internal:     true,
 		OnEvent: func(c *AdapterContext) error {
 			if err := instance.sendToSessionWS(session, c.Message); err != nil {
 				instance.ReportSessionError(session, "couldn't send received message", err)
@@ -91,6 +180,9 @@ func (instance *Instance[T]) createSession(session *Session[T]) {
 			instance.RemoveAdapter(sessionAdapterName)
 		},
 	})
+	if err != nil {
+		instance.ReportSessionError(session, "couldn't register session adapter", err)
+	}
 
 	sessionAny, ok := instance.sessionsCache.sessions.Load(session.GetUserId())
 	if ok {
@@ -159,8 +251,19 @@ func (instance *Instance[T]) GetSessions(userId string) []string {
 	}
 	sessions := sessionList.(*SessionsList)
 	sessions.mutex.RLock()
-	sessionIds := sessions.sessions
+	sessionIds := slices.Clone(sessions.sessions)
 	sessions.mutex.RUnlock()
 
 	return sessionIds
 }
+
+// Sorted list of all users that currently have sessions.
+func (instance *Instance[T]) GetUsers() []string {
+	users := []string{}
+	instance.sessionsCache.sessions.Range(func(key, _ any) bool {
+		users = append(users, key.(string))
+		return true
+	})
+	slices.Sort(users)
+	return users
+}
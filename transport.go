@@ -0,0 +1,167 @@
+package neogate
+
+import (
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Framework-neutral view of the request a client sent to create a session (e.g. the websocket upgrade request).
+type HandshakeRequest struct {
+	Method     string
+	Host       string // Host the request was sent to (used to check the Origin header, see Config.CheckOrigin)
+	Path       string
+	RemoteAddr string // Address of the peer that sent the request (ip:port)
+	Header     http.Header
+	Query      url.Values
+
+	// The request of the framework used by the transport (*fiber.Ctx for MountGateway, *http.Request for HTTPHandler).
+	// Only valid while the handshake is running (nil for Config.Authenticate).
+	Raw any
+}
+
+// Get the first value of a header.
+func (req *HandshakeRequest) Get(key string) string {
+	return req.Header.Get(key)
+}
+
+// Get the value of a cookie (empty in case it doesn't exist).
+//
+// Browsers send cookies with websocket requests from other sites too, so only authenticate using cookies in case
+// Config.CheckOrigin doesn't allow any other sites (it doesn't by default).
+func (req *HandshakeRequest) Cookie(name string) string {
+	for _, line := range req.Header.Values("Cookie") {
+		cookies, err := http.ParseCookie(line)
+		if err != nil {
+			continue
+		}
+		for _, cookie := range cookies {
+			if cookie.Name == name {
+				return cookie.Value
+			}
+		}
+	}
+	return ""
+}
+
+// Returned by Accept in case the handshake failed. Transports respond with the status and headers.
+type HandshakeError struct {
+	Status  int
+	Message string
+	Header  http.Header
+}
+
+func (err *HandshakeError) Error() string {
+	return err.Message
+}
+
+// Accept runs the handshake for a request. Transports call this before accepting the connection
+// and hand the returned session info to Run once the connection is established.
+//
+// Transports that fail to establish the connection after this have to give back its slot using ReleaseAdmission
+// (sessions give it back once they're closed).
+func (instance *Instance[T]) Accept(req *HandshakeRequest) (SessionInfo[T], *HandshakeError) {
+	if !instance.checkOrigin(req) {
+		Log.Println("closed connection: origin not allowed:", req.Get("Origin"))
+		return SessionInfo[T]{}, &HandshakeError{
+			Status:  http.StatusForbidden,
+			Message: "origin not allowed",
+		}
+	}
+
+	// Make sure the gateway can take another connection before doing any work
+	slot, handshakeErr := instance.admit(req)
+	if handshakeErr != nil {
+		return SessionInfo[T]{}, handshakeErr
+	}
+
+	info, handshakeErr := instance.handshake(req)
+	if handshakeErr != nil {
+		slot.release()
+		return SessionInfo[T]{}, handshakeErr
+	}
+	info.slot = slot
+	return info, nil
+}
+
+// Check if the site that sent the request is allowed to connect (see Config.CheckOrigin).
+func (instance *Instance[T]) checkOrigin(req *HandshakeRequest) bool {
+	if instance.Config.CheckOrigin != nil {
+		return instance.Config.CheckOrigin(req)
+	}
+
+	// Only browsers send the header, other clients can't be tricked into connecting
+	origin := req.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, req.Host)
+}
+
+// Run the handshake of Config.Handshake (or prepare the authentication using the first message).
+func (instance *Instance[T]) handshake(req *HandshakeRequest) (SessionInfo[T], *HandshakeError) {
+
+	// Authentication happens with the first message in case that's enabled
+	if instance.Config.Authenticate != nil {
+		pending := *req
+		pending.Raw = nil // The request of the framework is gone by the time the message arrives
+		return SessionInfo[T]{pending: &pending}, nil
+	}
+
+	info, ok := instance.Config.Handshake(req)
+	if !ok {
+		Log.Println("closed connection: invalid auth token")
+		return SessionInfo[T]{}, &HandshakeError{
+			Status:  http.StatusBadRequest,
+			Message: "handshake failed",
+		}
+	}
+
+	if handshakeErr := instance.checkSessionLimit(info.UserId); handshakeErr != nil {
+		return SessionInfo[T]{}, handshakeErr
+	}
+
+	// Create a unique session id to identify this specific session
+	info.sessionId = instance.newSessionId(info.UserId)
+	info.metadata = instance.captureMetadata(req)
+
+	return info, nil
+}
+
+// Run the session on a connection accepted by a transport until the connection is closed (closes it afterwards).
+func (instance *Instance[T]) Run(conn Conn, info SessionInfo[T]) {
+	accepted := info // The info is replaced in case the session authenticates with its first message
+	defer func() {
+		if err := recover(); err != nil {
+			Log.Println("There was an error with a connection: ", err)
+			debug.PrintStack()
+		}
+
+		// Close the connection
+		conn.Close()
+		instance.ReleaseAdmission(accepted)
+	}()
+
+	if info.pending != nil {
+		var ok bool
+		if info, ok = instance.authenticate(conn, info.pending); !ok {
+			return
+		}
+		info.slot = accepted.slot
+	}
+
+	// Make sure there is an infinite read timeout again (1 week should be enough)
+	conn.SetReadDeadline(time.Now().Add(time.Hour * 24 * 7))
+
+	session, ok := instance.Open(conn, info)
+	if !ok {
+		return
+	}
+	instance.Serve(session)
+}
@@ -0,0 +1,104 @@
+package neogate
+
+import (
+	"bufio"
+	"net/http"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/gofiber/websocket/v2"
+)
+
+// Mount the neogate gateway using a fiber router.
+func (instance *Instance[T]) MountGateway(router fiber.Router) {
+
+	// Inject a middleware to check if the request is a websocket upgrade request
+	router.Use("/", func(c *fiber.Ctx) error {
+
+		// Check if it is a websocket upgrade request
+		if websocket.IsWebSocketUpgrade(c) {
+			info, handshakeErr := instance.Accept(fiberHandshakeRequest(c))
+			if handshakeErr != nil {
+				return sendFiberHandshakeError(c, handshakeErr)
+			}
+
+			c.Locals("info", info)
+
+			// Run isn't called in case the upgrade failed
+			if err := c.Next(); err != nil {
+				instance.ReleaseAdmission(info)
+				return err
+			}
+			return nil
+		}
+
+		if instance.Config.EnableFallback && isFallbackRequest(c.Method(), c.Get(fiber.HeaderAccept)) {
+			return instance.handleFiberFallback(c)
+		}
+
+		return c.SendStatus(fiber.StatusUpgradeRequired)
+	})
+
+	// Mount an endpoint for actually receiving the websocket connection
+	router.Get("/", websocket.New(func(c *websocket.Conn) {
+		instance.Run(c, c.Locals("info").(SessionInfo[T]))
+	}))
+}
+
+// Handle a request for the fallback transport (event stream or posted action).
+func (instance *Instance[T]) handleFiberFallback(c *fiber.Ctx) error {
+	if c.Method() == fiber.MethodPost {
+		// The body is reused by fasthttp after the handler returned, but the message is read later
+		return c.SendStatus(instance.postFallback(c.Get(FallbackTokenHeader), utils.CopyBytes(c.Body())))
+	}
+
+	conn, handshakeErr := instance.openFallback(fiberHandshakeRequest(c))
+	if handshakeErr != nil {
+		return sendFiberHandshakeError(c, handshakeErr)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+
+		// Fasthttp only notices the client going away when writing fails
+		conn.stream(w, w.Flush, nil)
+	})
+	return nil
+}
+
+// Convert the fiber request to a handshake request.
+func fiberHandshakeRequest(c *fiber.Ctx) *HandshakeRequest {
+	header := http.Header{}
+	for key, values := range c.GetReqHeaders() {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	query := url.Values{}
+	for key, value := range c.Queries() {
+		query.Add(key, value)
+	}
+
+	return &HandshakeRequest{
+		Method:     c.Method(),
+		Host:       string(c.Request().Host()),
+		Path:       c.Path(),
+		RemoteAddr: c.Context().RemoteAddr().String(),
+		Header:     header,
+		Query:      query,
+		Raw:        c,
+	}
+}
+
+func sendFiberHandshakeError(c *fiber.Ctx, err *HandshakeError) error {
+	for key, values := range err.Header {
+		for _, value := range values {
+			c.Set(key, value)
+		}
+	}
+	return c.SendStatus(err.Status)
+}
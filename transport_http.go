@@ -0,0 +1,107 @@
+package neogate
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/fasthttp/websocket"
+)
+
+// Create a net/http handler for the neogate gateway (for services using net/http or routers built on it, like chi).
+func (instance *Instance[T]) HTTPHandler() http.Handler {
+	upgrader := &websocket.Upgrader{
+
+		// Already checked by Accept (see Config.CheckOrigin)
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Check if it is a websocket upgrade request
+		if !websocket.IsWebSocketUpgrade(r) {
+			if instance.Config.EnableFallback && isFallbackRequest(r.Method, r.Header.Get("Accept")) {
+				instance.handleHTTPFallback(w, r)
+				return
+			}
+
+			w.WriteHeader(http.StatusUpgradeRequired)
+			return
+		}
+
+		info, handshakeErr := instance.Accept(httpHandshakeRequest(r))
+		if handshakeErr != nil {
+			sendHTTPHandshakeError(w, handshakeErr)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader already responded with an error
+			instance.ReportGeneralError("couldn't upgrade connection", err)
+			instance.ReleaseAdmission(info)
+			return
+		}
+
+		instance.Run(conn, info)
+	})
+}
+
+// Handle a request for the fallback transport (event stream or posted action).
+func (instance *Instance[T]) handleHTTPFallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(instance.postFallback(r.Header.Get(FallbackTokenHeader), body))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		instance.ReportGeneralError("couldn't stream events", errors.New("response writer doesn't support flushing"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	conn, handshakeErr := instance.openFallback(httpHandshakeRequest(r))
+	if handshakeErr != nil {
+		sendHTTPHandshakeError(w, handshakeErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	conn.stream(w, func() error {
+		flusher.Flush()
+		return nil
+	}, r.Context().Done())
+}
+
+// Convert the net/http request to a handshake request.
+func httpHandshakeRequest(r *http.Request) *HandshakeRequest {
+	return &HandshakeRequest{
+		Method:     r.Method,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header.Clone(),
+		Query:      r.URL.Query(),
+		Raw:        r,
+	}
+}
+
+func sendHTTPHandshakeError(w http.ResponseWriter, err *HandshakeError) {
+	for key, values := range err.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(err.Status)
+}
@@ -0,0 +1,69 @@
+package neogate_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Liphium/neogate"
+	"github.com/fasthttp/websocket"
+)
+
+func TestHTTPHandlerOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		origin      string // "self" is replaced with the url of the server
+		checkOrigin func(req *neogate.HandshakeRequest) bool
+		status      int
+	}{
+		{name: "no origin", status: http.StatusSwitchingProtocols},
+		{name: "same origin", origin: "self", status: http.StatusSwitchingProtocols},
+		{name: "other origin", origin: "https://evil.example", status: http.StatusForbidden},
+		{name: "invalid origin", origin: "://", status: http.StatusForbidden},
+		{
+			name:   "allowed by config",
+			origin: "https://app.example",
+			checkOrigin: func(req *neogate.HandshakeRequest) bool {
+				return req.Get("Origin") == "https://app.example"
+			},
+			status: http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "rejected by config",
+			origin: "self",
+			checkOrigin: func(req *neogate.HandshakeRequest) bool {
+				return false
+			},
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{CheckOrigin: test.checkOrigin})
+			server := httptest.NewServer(harness.Instance.HTTPHandler())
+			defer server.Close()
+
+			header := http.Header{"User": {"alice"}}
+			switch test.origin {
+			case "":
+			case "self":
+				header.Set("Origin", server.URL)
+			default:
+				header.Set("Origin", test.origin)
+			}
+
+			conn, res, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+			if conn != nil {
+				conn.Close()
+			}
+			if res == nil {
+				t.Fatalf("no response: %s", err)
+			}
+			if res.StatusCode != test.status {
+				t.Fatalf("status = %d, want %d", res.StatusCode, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package neogate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/fasthttp/websocket"
+)
+
+// Config for serving raw stream connections (TCP, Unix sockets) using ServeListener.
+//
+// Every frame is a 4 byte big endian length followed by the message (same envelope as over websocket).
+// The first frame sent by the client is the handshake, the server answers it with {"success": bool, "status": int, "message": string}
+// and closes the connection in case it failed.
+type StreamConfig struct {
+
+	// Converts the handshake frame to a handshake request (which is then passed to Config.Handshake).
+	// By default the frame is parsed as {"path": string, "header": {key: value}, "query": {key: value}}.
+	ParseHandshake func(conn net.Conn, frame []byte) (*HandshakeRequest, error)
+
+	HandshakeTimeout time.Duration // How long the client has to send the handshake frame (default: 10s)
+	MaxFrameSize     uint32        // Frames bigger than this close the connection (default: 16 MiB)
+}
+
+type streamHandshake struct {
+	Path   string            `json:"path"`
+	Header map[string]string `json:"header"`
+	Query  map[string]string `json:"query"`
+}
+
+type streamHandshakeResponse struct {
+	Success bool   `json:"success"`
+	Status  int    `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Accept stream connections from the listener until it or the instance is closed (use net.Listen with "tcp" or "unix").
+//
+// Temporary errors (like running out of file descriptors) are retried with a delay, like http.Server does.
+func (instance *Instance[T]) ServeListener(listener net.Listener, config StreamConfig) error {
+	if config.ParseHandshake == nil {
+		config.ParseHandshake = defaultStreamHandshake
+	}
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = 10 * time.Second
+	}
+	if config.MaxFrameSize == 0 {
+		config.MaxFrameSize = 16 << 20
+	}
+
+	// Stop accepting once the instance is closed
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-instance.closed:
+			listener.Close()
+		case <-done:
+		}
+	}()
+
+	var retryDelay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			var temporary interface{ Temporary() bool }
+			if !errors.As(err, &temporary) || !temporary.Temporary() {
+				return err
+			}
+			retryDelay = min(max(retryDelay*2, 5*time.Millisecond), time.Second)
+			instance.ReportGeneralError(fmt.Sprintf("couldn't accept stream connection, retrying in %s", retryDelay), err)
+
+			select {
+			case <-instance.closed:
+				return nil
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		retryDelay = 0
+
+		go instance.handleStream(conn, config)
+	}
+}
+
+func (instance *Instance[T]) handleStream(netConn net.Conn, config StreamConfig) {
+	conn := &streamConn{
+		conn:         netConn,
+		writeMutex:   &sync.Mutex{},
+		maxFrameSize: config.MaxFrameSize,
+	}
+
+	// Read the handshake
+	conn.SetReadDeadline(time.Now().Add(config.HandshakeTimeout))
+	_, frame, err := conn.ReadMessage()
+	if err != nil {
+		netConn.Close()
+		return
+	}
+
+	req, err := config.ParseHandshake(netConn, frame)
+	if err != nil {
+		conn.writeHandshakeResponse(streamHandshakeResponse{Status: http.StatusBadRequest, Message: err.Error()})
+		netConn.Close()
+		return
+	}
+
+	info, handshakeErr := instance.Accept(req)
+	if handshakeErr != nil {
+		conn.writeHandshakeResponse(streamHandshakeResponse{Status: handshakeErr.Status, Message: handshakeErr.Message})
+		netConn.Close()
+		return
+	}
+	if err := conn.writeHandshakeResponse(streamHandshakeResponse{Success: true}); err != nil {
+		netConn.Close()
+		instance.ReleaseAdmission(info)
+		return
+	}
+
+	instance.Run(conn, info)
+}
+
+// Parses the handshake frame as json.
+func defaultStreamHandshake(conn net.Conn, frame []byte) (*HandshakeRequest, error) {
+	var handshake streamHandshake
+	if err := sonic.Unmarshal(frame, &handshake); err != nil {
+		return nil, fmt.Errorf("invalid handshake: %w", err)
+	}
+
+	req := &HandshakeRequest{
+		Path:   handshake.Path,
+		Header: http.Header{},
+		Query:  url.Values{},
+		Raw:    conn,
+	}
+	if conn.RemoteAddr() != nil {
+		req.RemoteAddr = conn.RemoteAddr().String()
+	}
+	for key, value := range handshake.Header {
+		req.Header.Set(key, value)
+	}
+	for key, value := range handshake.Query {
+		req.Query.Set(key, value)
+	}
+	return req, nil
+}
+
+// Conn using length-prefixed frames over a raw stream.
+type streamConn struct {
+	conn         net.Conn
+	writeMutex   *sync.Mutex
+	maxFrameSize uint32
+}
+
+func (conn *streamConn) ReadMessage() (int, []byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(conn.conn, length[:]); err != nil {
+		return 0, nil, streamReadError(err)
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size > conn.maxFrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes is bigger than the maximum of %d", size, conn.maxFrameSize)
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(conn.conn, frame); err != nil {
+		return 0, nil, streamReadError(err)
+	}
+	return websocket.BinaryMessage, frame, nil
+}
+
+// The client closing the connection is a normal closure (like a close frame over websocket).
+func streamReadError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	}
+	return err
+}
+
+// Only data messages are sent, streams don't have control frames.
+func (conn *streamConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		return nil
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+
+	_, err := conn.conn.Write(frame)
+	return err
+}
+
+func (conn *streamConn) SetReadDeadline(t time.Time) error {
+	return conn.conn.SetReadDeadline(t)
+}
+
+func (conn *streamConn) Close() error {
+	return conn.conn.Close()
+}
+
+func (conn *streamConn) writeHandshakeResponse(response streamHandshakeResponse) error {
+	msg, err := sonic.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.BinaryMessage, msg)
+}
@@ -0,0 +1,223 @@
+package neogate_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Liphium/neogate"
+	"github.com/bytedance/sonic"
+)
+
+func writeFrame(t *testing.T, conn net.Conn, data []byte) {
+	t.Helper()
+
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	if _, err := conn.Write(append(frame, data...)); err != nil {
+		t.Fatalf("couldn't write frame: %s", err)
+	}
+}
+
+// Read a frame (returns an error in case the connection was closed).
+func readFrame(conn net.Conn) ([]byte, error) {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	frame := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(conn, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// The server resets the connection in case it closes it before reading everything.
+func closedByPeer(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+type streamHandshakeResponse struct {
+	Success bool   `json:"success"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// Serve the instance on a unix socket. Returns the address of the socket and a channel for the result of ServeListener.
+func serveStream(t *testing.T, instance *neogate.Instance[neogate.None], config neogate.StreamConfig) (string, chan error) {
+	t.Helper()
+
+	address := filepath.Join(t.TempDir(), "neogate.sock")
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatalf("couldn't listen: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	result := make(chan error, 1)
+	go func() {
+		result <- instance.ServeListener(listener, config)
+	}()
+	return address, result
+}
+
+func TestStreamTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		handshake string
+		status    int    // Status of the handshake response (0 = success)
+		frame     []byte // Sent after the handshake
+		response  string // Name of the event received for the frame (empty = the connection is closed)
+	}{
+		{
+			name:      "round trip",
+			handshake: `{"header":{"User":"alice"}}`,
+			frame:     []byte(`{"action":"echo:1","data":{"message":"hello"}}`),
+			response:  "res:echo:1",
+		},
+		{
+			name:      "rejected handshake",
+			handshake: `{"header":{}}`,
+			status:    400,
+		},
+		{
+			name:      "invalid handshake",
+			handshake: `not json`,
+			status:    400,
+		},
+		{
+			name:      "frame too big",
+			handshake: `{"header":{"User":"alice"}}`,
+			frame:     make([]byte, 1025),
+		},
+		{
+			name:      "frame at maximum size",
+			handshake: `{"header":{"User":"alice"}}`,
+			frame:     []byte(`{"action":"echo:2","data":{"message":"` + strings.Repeat("x", 1024-41) + `"}}`),
+			response:  "res:echo:2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness := newHarness(t, neogate.Config[neogate.None]{
+				Handshake: func(req *neogate.HandshakeRequest) (neogate.SessionInfo[neogate.None], bool) {
+					return neogate.SessionInfo[neogate.None]{UserId: req.Get("User")}, req.Get("User") != ""
+				},
+			})
+			neogate.CreateHandlerFor(harness.Instance, "echo", func(c *neogate.Context[neogate.None], action map[string]string) neogate.Event {
+				return neogate.NormalResponse(c, action)
+			})
+			address, _ := serveStream(t, harness.Instance, neogate.StreamConfig{MaxFrameSize: 1024})
+
+			conn, err := net.Dial("unix", address)
+			if err != nil {
+				t.Fatalf("couldn't connect: %s", err)
+			}
+			defer conn.Close()
+
+			writeFrame(t, conn, []byte(test.handshake))
+			frame, err := readFrame(conn)
+			if err != nil {
+				t.Fatalf("couldn't read handshake response: %s", err)
+			}
+			var response streamHandshakeResponse
+			if err := sonic.Unmarshal(frame, &response); err != nil {
+				t.Fatalf("invalid handshake response %q: %s", frame, err)
+			}
+			if response.Success != (test.status == 0) || response.Status != test.status {
+				t.Fatalf("handshake response = %+v, want status %d", response, test.status)
+			}
+			if test.status != 0 {
+				if _, err := readFrame(conn); !closedByPeer(err) {
+					t.Fatalf("connection wasn't closed after the rejected handshake: %v", err)
+				}
+				return
+			}
+
+			writeFrame(t, conn, test.frame)
+			frame, err = readFrame(conn)
+			if test.response == "" {
+				if !closedByPeer(err) {
+					t.Fatalf("connection wasn't closed: %q, %v", frame, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("couldn't read response: %s", err)
+			}
+			var event neogate.Event
+			if err := sonic.Unmarshal(frame, &event); err != nil || event.Name != test.response {
+				t.Fatalf("received %q, want %s (%v)", frame, test.response, err)
+			}
+		})
+	}
+}
+
+// Listener that fails with temporary errors before accepting connections.
+type flakyListener struct {
+	net.Listener
+	failures *atomic.Int32
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Temporary() bool { return true }
+func (temporaryError) Timeout() bool   { return false }
+
+func (listener *flakyListener) Accept() (net.Conn, error) {
+	if listener.failures.Add(-1) >= 0 {
+		return nil, temporaryError{}
+	}
+	return listener.Listener.Accept()
+}
+
+func TestServeListenerRetriesAndStops(t *testing.T) {
+	harness := newHarness(t, neogate.Config[neogate.None]{})
+
+	address := filepath.Join(t.TempDir(), "neogate.sock")
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatalf("couldn't listen: %s", err)
+	}
+	failures := &atomic.Int32{}
+	failures.Store(3)
+	result := make(chan error, 1)
+	go func() {
+		result <- harness.Instance.ServeListener(&flakyListener{Listener: listener, failures: failures}, neogate.StreamConfig{})
+	}()
+
+	// Connections are still accepted after the temporary errors
+	conn, err := net.Dial("unix", address)
+	if err != nil {
+		t.Fatalf("couldn't connect: %s", err)
+	}
+	defer conn.Close()
+	writeFrame(t, conn, []byte(`{"header":{"User":"alice"}}`))
+	if _, err := readFrame(conn); err != nil {
+		t.Fatalf("couldn't read handshake response: %s", err)
+	}
+
+	// Closing the instance stops the listener
+	harness.Instance.Close()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("ServeListener returned %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeListener didn't stop")
+	}
+	if _, err := net.Dial("unix", address); err == nil {
+		t.Fatal("listener still accepts connections")
+	}
+}
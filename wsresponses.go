@@ -33,8 +33,14 @@ func ErrorResponse[T any](ctx *Context[T], message string, err error) Event {
 }
 
 func Response[T any](ctx *Context[T], data any) Event {
-	return Event{
+	event := Event{
 		Name: "res:" + ctx.Action + ":" + ctx.ResponseId,
 		Data: data,
 	}
+
+	// Responses belong to the request of the client
+	if ctx.Instance != nil && ctx.Instance.Config.EventMetadata {
+		event.CorrelationID = ctx.ResponseId
+	}
+	return event
 }